@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kken7231/screensaver/display"
+	"github.com/kken7231/screensaver/layout"
+	"github.com/kken7231/screensaver/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth guards the admin API with the bearer token.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		}
+	}
+}
+
+// RegisterAdminRoutes registers the routes of the admin API, which lists the displays and sends them commands.
+// Without a token, the admin API is not registered at all.
+func RegisterAdminRoutes(r *gin.Engine, registry *display.Registry, scheduler *display.Scheduler, token string) {
+	if token == "" {
+		log.Printf("The admin API is disabled, as no admin token is set")
+		return
+	}
+	admin := r.Group(util.API_ROOT_PATH+"/admin", AdminAuth(token))
+
+	// Handler listing the known displays, connected or not.
+	admin.GET("/displays", func(c *gin.Context) {
+		c.JSON(http.StatusOK, registry.List())
+	})
+
+	// Handler for a single display.
+	admin.GET("/displays/:id", func(c *gin.Context) {
+		d, ok := registry.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": display.ErrUnknownDisplay.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	})
+
+	// Handler for the layout the schedule of a display shows now, and when it changes next.
+	admin.GET("/displays/:id/schedule", func(c *gin.Context) {
+		active, ok := scheduler.Active(c.Param("id"), time.Now())
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no schedule applies to the display"})
+			return
+		}
+		c.JSON(http.StatusOK, active)
+	})
+
+	// Handler sending a command to a display.
+	admin.POST("/displays/:id/commands", func(c *gin.Context) {
+		var err error
+		var command display.Command
+		var layoutNames []string
+
+		if err = c.ShouldBindJSON(&command); err != nil {
+			goto api_admin_command_err
+		}
+		if err = command.Validate(); err != nil {
+			goto api_admin_command_err
+		}
+		// Only existing layouts can be assigned.
+		if command.Action == display.COMMAND_LAYOUT {
+			layoutNames, err = layout.LayoutNames()
+			if err != nil {
+				goto api_admin_command_err
+			}
+			if !slices.Contains(layoutNames, command.Layout) {
+				err = fmt.Errorf("unknown layout \"%s\"", command.Layout)
+				goto api_admin_command_err
+			}
+		}
+
+		err = registry.Send(c.Param("id"), command)
+		if errors.Is(err, display.ErrUnknownDisplay) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			goto api_admin_command_err
+		}
+		c.Status(http.StatusNoContent)
+		return
+
+	api_admin_command_err:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	})
+
+	// Handler clearing the layout assigned to a display.
+	admin.DELETE("/displays/:id/layout", func(c *gin.Context) {
+		if err := registry.Unassign(c.Param("id")); errors.Is(err, display.ErrUnknownDisplay) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Handler forgetting a display and its assigned layout.
+	admin.DELETE("/displays/:id", func(c *gin.Context) {
+		if err := registry.Forget(c.Param("id")); errors.Is(err, display.ErrUnknownDisplay) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
@@ -4,12 +4,19 @@ package main
 import (
 	"bytes"
 	"cmp"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"log"
 	"net/http"
 	"slices"
+	"strconv"
 	"time"
 
+	"github.com/kken7231/screensaver/astro"
+	"github.com/kken7231/screensaver/display"
+	"github.com/kken7231/screensaver/jpcal"
 	"github.com/kken7231/screensaver/layout"
 	"github.com/kken7231/screensaver/notion"
 	"github.com/kken7231/screensaver/util"
@@ -27,14 +34,14 @@ func DrawHorizontalLines(minHours, maxHours int, now time.Time) (string, error)
 	nRow := maxHours - minHours + 1
 
 	// Parse the template file for the calendar widget.
-	tmpl, err := template.New("eventTmpl").ParseFiles("templates/util.tmpl")
+	tmpl, err := layout.Template("util.tmpl")
 	if err != nil {
 		err = fmt.Errorf("failed to find a template for notioncalendar Widget: %v", err)
 		goto api_drawhorizontallines_finish
 	}
 
-	// Calculate the current minute within the specified hour range.
-	minNow = (now.Hour()-minHours)*60 + now.Minute()
+	// Calculate the current minute of the day, hidden outside the specified hour range.
+	minNow = now.Hour()*60 + now.Minute()
 	initialVisibility = "visible"
 	if minNow < minHours*60 || minNow > maxHours*60 {
 		initialVisibility = "hidden"
@@ -46,6 +53,7 @@ func DrawHorizontalLines(minHours, maxHours int, now time.Time) (string, error)
 		"nRow":              nRow,
 		"minNow":            minNow,
 		"minHours":          minHours,
+		"maxHours":          maxHours,
 		"initialVisibility": initialVisibility,
 	})
 	if err != nil {
@@ -73,14 +81,123 @@ api_drawhorizontallines_finish:
 	return buf.String(), err
 }
 
+// HISTORY_GRAPH_WIDTH and HISTORY_GRAPH_HEIGHT are the viewBox dimensions of history graphs.
+const (
+	HISTORY_GRAPH_WIDTH  = 100.0
+	HISTORY_GRAPH_HEIGHT = 40.0
+)
+
+// DrawHistoryGraph renders the SVG graph of the weather history widget.
+func DrawHistoryGraph(band string, lines []map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+
+	tmpl, err := layout.Template("widgets/weatherhistory.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a template for weatherhistory Widget: %v", err)
+	}
+
+	err = tmpl.ExecuteTemplate(&buf, "graph", gin.H{
+		"width":  HISTORY_GRAPH_WIDTH,
+		"height": HISTORY_GRAPH_HEIGHT,
+		"band":   band,
+		"lines":  lines,
+	})
+	if err != nil {
+		return "", fmt.Errorf("template execution failed for weatherhistory Widget: %v", err)
+	}
+	return buf.String(), nil
+}
+
 // RegisterApiRoutes registers the API routes for the application.
-func RegisterApiRoutes(r *gin.Engine) {
+func RegisterApiRoutes(r *gin.Engine, client *http.Client, historyStore *weather.HistoryStore, forecastTracker *weather.ForecastTracker, quakeFeed *weather.QuakeFeed, adviceRules weather.AdviceRules, calendarSources []notion.CalendarSource, hub *util.Hub, watcher *layout.Watcher, registry *display.Registry) {
+	// Handler for the push channel of the displays, streaming server-sent events.
+	// The display registers with the client ID of its cookie, layout and resolution, and receives its commands besides the reloads.
+	// The validation errors of the edited files and the brightness of the display are sent first.
+	r.GET(util.API_ROOT_PATH+"/events", func(c *gin.Context) {
+		client_id, ok := registry.IssuedClientID(c)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "please load the page to get a client ID"})
+			return
+		}
+		width, _ := strconv.Atoi(c.Query("width"))
+		height, _ := strconv.Atoi(c.Query("height"))
+		commands, state, err := registry.Connect(display.Display{
+			ID:         client_id,
+			Showing:    c.Query("layout"),
+			Width:      width,
+			Height:     height,
+			UserAgent:  c.Request.UserAgent(),
+			RemoteAddr: c.ClientIP(),
+		})
+		if errors.Is(err, display.ErrTooManyDisplays) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer registry.Disconnect(state.ID, commands)
+		messages := hub.Subscribe()
+		defer hub.Unsubscribe(messages)
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Accel-Buffering", "no")
+		for file, message := range watcher.Failures() {
+			c.SSEvent(layout.RELOAD_ERROR_EVENT, layout.ReloadErrorEvent{File: file, Message: message})
+		}
+		for _, command := range state.StateCommands() {
+			c.SSEvent(display.COMMAND_EVENT, command)
+		}
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(util.EVENTS_KEEPALIVE_INTERVAL)
+		defer keepAlive.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case message, ok := <-messages:
+				if !ok {
+					return false
+				}
+				c.SSEvent(message.Event, message.Data)
+			case message, ok := <-commands:
+				if !ok {
+					return false
+				}
+				c.SSEvent(message.Event, message.Data)
+			case <-keepAlive.C:
+				registry.Seen(state.ID)
+				c.SSEvent("ping", time.Now().UnixMilli())
+			}
+			return true
+		})
+	})
+
+	// Handler for the server time, with which the displays correct the drift of their clocks.
+	// The originate time of the request is echoed back with the receive and transmit times, as in NTP.
+	r.GET(util.API_ROOT_PATH+"/time", func(c *gin.Context) {
+		receive := time.Now()
+		originate, err := strconv.ParseInt(c.Query("originate"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "please provide the originate time in milliseconds"})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{
+			"originate": originate,
+			"receive":   receive.UnixMilli(),
+			"transmit":  time.Now().UnixMilli(),
+		})
+	})
+
 	// Handler for weather forecast API endpoint.
 	r.GET(util.API_ROOT_PATH+"/weatherforecast", func(c *gin.Context) {
 		var err error
 		var data map[string]interface{}
 		var result weather.RawForecastData
 		var forecastData weather.ForecastData
+		var timezone string
 		nHour := 5
 		nDay := 5
 
@@ -89,9 +206,13 @@ func RegisterApiRoutes(r *gin.Engine) {
 		if err != nil {
 			goto api_weatherforecast_err
 		}
+		timezone, err = weather.LocationTimezone(c.Query("location_timezone"))
+		if err != nil {
+			goto api_weatherforecast_err
+		}
 
 		// Fetch the weather forecast data.
-		result, err = weather.FetchForecastData(latitude, longitude, nDay)
+		result, err = weather.FetchForecastData(c.Request.Context(), client, latitude, longitude, timezone, nDay)
 		if err != nil {
 			goto api_weatherforecast_err
 		}
@@ -119,12 +240,14 @@ func RegisterApiRoutes(r *gin.Engine) {
 
 			graphData := map[string]string{}
 			allHistData := []weather.HistoricalData{}
-			for i := 0; i <= now.Hour()/3; i++ {
-				rawHistData, err := weather.FetchHistWeatherData(amedas_code, now, i)
-				if err != nil {
-					goto api_weatherforecast_err
-				}
-				histData, err := weather.ParseHistWeatherData(rawHistData)
+			var chunks []weather.RawHistoricalDataMap
+			chunks, err = weather.FetchHistWeatherDataOfDay(c.Request.Context(), client, amedas_code, now, now.Hour()/3)
+			if err != nil {
+				goto api_weatherforecast_err
+			}
+			for _, rawHistData := range chunks {
+				var histData []weather.HistoricalData
+				histData, err = weather.ParseHistWeatherData(rawHistData)
 				if err != nil {
 					goto api_weatherforecast_err
 				}
@@ -135,12 +258,21 @@ func RegisterApiRoutes(r *gin.Engine) {
 				return cmp.Compare(a.Timestamp, b.Timestamp)
 			})
 			for _, histData := range allHistData {
-				graphData["temp"] += fmt.Sprintf("%f, ", histData.Temp)
+				if histData.Temp != nil {
+					graphData["temp"] += fmt.Sprintf("%f, ", *histData.Temp)
+				}
 			}
 		}
 
 		data = util.MergeMaps(data, util.StructToMap(forecastData))
 
+		// Add the lifestyle indices derived from the forecast and the latest observation.
+		if advice, err := weather.ComputeAdvice(result, weather.LatestObservation(historyStore, amedas_code, time.Now()), adviceRules, time.Now()); err == nil {
+			data["advice"] = util.StructToMap(advice)
+		} else {
+			log.Printf("Failed to compute the advice of %s: %v", location_name, err)
+		}
+
 		c.JSON(http.StatusOK, data)
 		return
 
@@ -148,11 +280,538 @@ func RegisterApiRoutes(r *gin.Engine) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	})
 
+	// Handler for rain alert API endpoint.
+	r.GET(util.API_ROOT_PATH+"/rainalert", func(c *gin.Context) {
+		var err error
+		var location_name, timezone string
+		var latitude, longitude float64
+		var result weather.RawForecastData
+		var nowcast weather.RainNowcast
+		var retData map[string]interface{}
+
+		// Check the query parameters for rain alert request.
+		_, location_name, latitude, longitude, err = weather.RainAlertCheckQuery(c)
+		if err != nil {
+			goto api_rainalert_err
+		}
+		timezone, err = weather.LocationTimezone(c.Query("location_timezone"))
+		if err != nil {
+			goto api_rainalert_err
+		}
+
+		// Fetch the forecast including the 15-minutely precipitation.
+		result, err = weather.FetchForecastData(c.Request.Context(), client, latitude, longitude, timezone, 1)
+		if err != nil {
+			goto api_rainalert_err
+		}
+
+		nowcast, err = weather.ParseRainNowcast(result, time.Now())
+		if err != nil {
+			goto api_rainalert_err
+		}
+
+		retData = util.StructToMap(nowcast)
+		retData["location_name"] = location_name
+		if nowcast.Alert != "" {
+			retData["alert"] = fmt.Sprintf("%s: %s", location_name, nowcast.Alert)
+		}
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_rainalert_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for lifestyle advice API endpoint.
+	r.GET(util.API_ROOT_PATH+"/advice", func(c *gin.Context) {
+		var err error
+		var location_name, amedas_code, timezone string
+		var latitude, longitude float64
+		var result weather.RawForecastData
+		var advice weather.Advice
+		var retData map[string]interface{}
+
+		// Check the query parameters for lifestyle advice request.
+		_, location_name, latitude, longitude, amedas_code, err = weather.AdviceCheckQuery(c)
+		if err != nil {
+			goto api_advice_err
+		}
+		timezone, err = weather.LocationTimezone(c.Query("location_timezone"))
+		if err != nil {
+			goto api_advice_err
+		}
+
+		result, err = weather.FetchForecastData(c.Request.Context(), client, latitude, longitude, timezone, 1)
+		if err != nil {
+			goto api_advice_err
+		}
+
+		advice, err = weather.ComputeAdvice(result, weather.LatestObservation(historyStore, amedas_code, time.Now()), adviceRules, time.Now())
+		if err != nil {
+			goto api_advice_err
+		}
+
+		retData = util.StructToMap(advice)
+		retData["location_name"] = location_name
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_advice_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for air quality API endpoint.
+	r.GET(util.API_ROOT_PATH+"/airquality", func(c *gin.Context) {
+		var err error
+		var location_name string
+		var latitude, longitude float64
+		var result weather.RawAirQualityData
+		var airQualityData weather.AirQualityData
+		var badge, hours bytes.Buffer
+		var tmpl *template.Template
+		var retData map[string]interface{}
+
+		// Check the query parameters for air quality request.
+		_, location_name, latitude, longitude, err = weather.AirQualityCheckQuery(c)
+		if err != nil {
+			goto api_airquality_err
+		}
+
+		result, err = weather.FetchAirQualityData(c.Request.Context(), client, latitude, longitude)
+		if err != nil {
+			goto api_airquality_err
+		}
+
+		airQualityData, err = weather.ParseAirQualityData(result, weather.AIR_QUALITY_HOURS)
+		if err != nil {
+			goto api_airquality_err
+		}
+
+		tmpl, err = layout.Template("widgets/airquality.tmpl")
+		if err != nil {
+			err = fmt.Errorf("failed to find a template for airquality Widget: %v", err)
+			goto api_airquality_err
+		}
+
+		// Render the color-coded AQI badges.
+		retData = util.StructToMap(airQualityData)
+		err = tmpl.ExecuteTemplate(&badge, "badge", retData)
+		if err != nil {
+			err = fmt.Errorf("template execution failed for airquality Widget: %v", err)
+			goto api_airquality_err
+		}
+		for _, hourly := range airQualityData.Hourly {
+			err = tmpl.ExecuteTemplate(&hours, "hour", util.StructToMap(hourly))
+			if err != nil {
+				err = fmt.Errorf("template execution failed for airquality Widget: %v", err)
+				goto api_airquality_err
+			}
+		}
+
+		retData["location_name"] = location_name
+		retData["badge"] = badge.String()
+		retData["hours"] = hours.String()
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_airquality_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for sky API endpoint.
+	r.GET(util.API_ROOT_PATH+"/sky", func(c *gin.Context) {
+		var err error
+		var location_name string
+		var latitude, longitude float64
+		var location *time.Location
+		var retData map[string]interface{}
+
+		// Check the query parameters for sky request.
+		_, location_name, latitude, longitude, location, err = astro.SkyCheckQuery(c)
+		if err != nil {
+			goto api_sky_err
+		}
+
+		retData = util.StructToMap(astro.ParseSkyData(time.Now().In(location), latitude, longitude))
+		retData["location_name"] = location_name
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_sky_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for the automatic dark mode API endpoint.
+	r.GET(util.API_ROOT_PATH+"/sky/theme", func(c *gin.Context) {
+		latitude, longitude, err := astro.ThemeCheckQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, astro.GetThemeData(time.Now(), latitude, longitude))
+	})
+
+	// Handler for weather comparison API endpoint.
+	r.GET(util.API_ROOT_PATH+"/weathercompare", func(c *gin.Context) {
+		var err error
+		var locations []weather.CompareLocation
+		var latitudes, longitudes []float64
+		var timezones []string
+		var results []weather.RawForecastData
+		var buf bytes.Buffer
+		var tmpl *template.Template
+
+		// Check the query parameters for weather comparison request.
+		_, locations, err = weather.WeatherCompareCheckQuery(c)
+		if err != nil {
+			goto api_weathercompare_err
+		}
+
+		// Fetch the forecasts of every location in one batched request.
+		for _, location := range locations {
+			latitudes = append(latitudes, location.Latitude)
+			longitudes = append(longitudes, location.Longitude)
+			timezones = append(timezones, location.Timezone)
+		}
+		results, err = weather.FetchForecastDataBatch(c.Request.Context(), client, latitudes, longitudes, timezones, 1)
+		if err != nil {
+			goto api_weathercompare_err
+		}
+
+		tmpl, err = layout.Template("widgets/weathercompare.tmpl")
+		if err != nil {
+			err = fmt.Errorf("failed to find a template for weathercompare Widget: %v", err)
+			goto api_weathercompare_err
+		}
+
+		// Execute the template for each location.
+		for i, result := range results {
+			var row weather.CompareRow
+			row, err = weather.ParseCompareRow(locations[i].Name, result)
+			if err != nil {
+				goto api_weathercompare_err
+			}
+			err = tmpl.ExecuteTemplate(&buf, "row", util.StructToMap(row))
+			if err != nil {
+				err = fmt.Errorf("template execution failed for weathercompare Widget: %v", err)
+				goto api_weathercompare_err
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"rows": buf.String()})
+		return
+
+	api_weathercompare_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for weather warnings API endpoint.
+	r.GET(util.API_ROOT_PATH+"/weatherwarnings", func(c *gin.Context) {
+		var err error
+		var location_name, area_code, office_code string
+		var areaTable *weather.RawAreaTable
+		var rawWarningData weather.RawWarningData
+		var warningData weather.WarningData
+		var buf bytes.Buffer
+		var tmpl *template.Template
+		var retData map[string]interface{}
+
+		// Check the query parameters for weather warnings request.
+		_, location_name, area_code, office_code, err = weather.WeatherWarningsCheckQuery(c)
+		if err != nil {
+			goto api_weatherwarnings_err
+		}
+
+		// Find the forecast office of the area unless given.
+		if office_code == "" {
+			areaTable, err = weather.FetchAreaTable(c.Request.Context(), client)
+			if err != nil {
+				goto api_weatherwarnings_err
+			}
+			office_code, err = areaTable.OfficeCodeOf(area_code)
+			if err != nil {
+				goto api_weatherwarnings_err
+			}
+		}
+
+		rawWarningData, err = weather.FetchWarningData(c.Request.Context(), client, office_code)
+		if err != nil {
+			goto api_weatherwarnings_err
+		}
+
+		warningData, err = weather.ParseWarningData(rawWarningData, area_code, location_name)
+		if err != nil {
+			goto api_weatherwarnings_err
+		}
+
+		tmpl, err = layout.Template("widgets/weatherwarnings.tmpl")
+		if err != nil {
+			err = fmt.Errorf("failed to find a template for weatherwarnings Widget: %v", err)
+			goto api_weatherwarnings_err
+		}
+
+		// Execute the template for each warning in effect.
+		if len(warningData.Warnings) == 0 {
+			buf.WriteString("<span>No warnings</span>")
+		}
+		for _, warning := range warningData.Warnings {
+			err = tmpl.ExecuteTemplate(&buf, "warning", util.StructToMap(warning))
+			if err != nil {
+				err = fmt.Errorf("template execution failed for weatherwarnings Widget: %v", err)
+				goto api_weatherwarnings_err
+			}
+		}
+
+		retData = util.StructToMap(warningData)
+		retData["location_name"] = location_name
+		retData["chips"] = buf.String()
+		retData["report_time"] = warningData.ReportDatetime
+		if reportTime, err := time.Parse(time.RFC3339, warningData.ReportDatetime); err == nil {
+			retData["report_time"] = reportTime.Format("Jan 2 15:04")
+		}
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_weatherwarnings_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for earthquake API endpoint.
+	r.GET(util.API_ROOT_PATH+"/quake", func(c *gin.Context) {
+		var err error
+		var size layout.WidgetSize
+		var areas []string
+		var threshold string
+		var events []weather.QuakeEvent
+		var updated time.Time
+		var count int
+		var quakeData weather.QuakeData
+		var buf bytes.Buffer
+		var tmpl *template.Template
+		var retData map[string]interface{}
+
+		// Check the query parameters for earthquake request.
+		size, areas, threshold, err = weather.QuakeCheckQuery(c)
+		if err != nil {
+			goto api_quake_err
+		}
+
+		// The earthquake list is fetched in the background by the quake collector.
+		events, updated = quakeFeed.Events()
+		count = 5
+		if size == layout.LongV {
+			count = 15
+		}
+		quakeData = weather.ParseQuakeData(events, updated, count, areas, threshold, time.Now())
+
+		tmpl, err = layout.Template("widgets/quake.tmpl")
+		if err != nil {
+			err = fmt.Errorf("failed to find a template for quake Widget: %v", err)
+			goto api_quake_err
+		}
+
+		// Execute the template for each recent earthquake.
+		if len(quakeData.Rows) == 0 {
+			buf.WriteString("<span>No recent earthquakes</span>")
+		}
+		for _, row := range quakeData.Rows {
+			err = tmpl.ExecuteTemplate(&buf, "row", util.StructToMap(row))
+			if err != nil {
+				err = fmt.Errorf("template execution failed for quake Widget: %v", err)
+				goto api_quake_err
+			}
+		}
+
+		retData = util.StructToMap(quakeData)
+		retData["rows"] = buf.String()
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_quake_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for the AMeDAS history series API endpoint.
+	r.GET(util.API_ROOT_PATH+"/weather/history", func(c *gin.Context) {
+		amedas_code := c.Query("amedas_code")
+		if !weather.ValidAmedasCode(amedas_code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "please provide a valid amedas location code"})
+			return
+		}
+
+		series, err := weather.GetHistorySeries(historyStore, amedas_code, c.DefaultQuery("range", "24h"), c.DefaultQuery("field", "temp"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, series)
+	})
+
+	// Handler for weather history widget API endpoint.
+	r.GET(util.API_ROOT_PATH+"/weatherhistory", func(c *gin.Context) {
+		var err error
+		var size layout.WidgetSize
+		var location_name, amedas_code, rangeName, band, graph string
+		var lines []map[string]interface{}
+		var lower, upper float64
+		var retData map[string]interface{}
+		now := time.Now()
+
+		// Check the query parameters for weather history request.
+		size, location_name, amedas_code, rangeName, err = weather.WeatherHistoryCheckQuery(c)
+		if err != nil {
+			goto api_weatherhistory_err
+		}
+
+		retData = map[string]interface{}{
+			"location_name": location_name,
+		}
+
+		if size == layout.MiddleH {
+			// Compare today's temperature curve with yesterday's.
+			var today, yesterday []weather.AggregatedPoint
+			today, err = weather.GetDaySeries(historyStore, amedas_code, "temp", now)
+			if err != nil {
+				goto api_weatherhistory_err
+			}
+			yesterday, err = weather.GetDaySeries(historyStore, amedas_code, "temp", now.AddDate(0, 0, -1))
+			if err != nil {
+				goto api_weatherhistory_err
+			}
+
+			lower, upper = weather.PointsBounds(today, yesterday)
+			lines = []map[string]interface{}{
+				{"points": weather.PlotPoints(yesterday, weather.MeanOf, lower, upper, HISTORY_GRAPH_WIDTH, HISTORY_GRAPH_HEIGHT), "color": template.CSS("var(--md-sys-color-on-primary-container)")},
+				{"points": weather.PlotPoints(today, weather.MeanOf, lower, upper, HISTORY_GRAPH_WIDTH, HISTORY_GRAPH_HEIGHT), "color": template.CSS("var(--md-sys-color-tertiary)")},
+			}
+			retData["title"] = "Yesterday vs Today"
+			retData["legend"] = "Today"
+		} else {
+			// Draw the mean curve over the min/max band of the range.
+			var series weather.HistorySeries
+			series, err = weather.GetHistorySeries(historyStore, amedas_code, rangeName, "temp", now)
+			if err != nil {
+				goto api_weatherhistory_err
+			}
+
+			lower, upper = weather.PointsBounds(series.Points)
+			band = weather.PlotBand(series.Points, lower, upper, HISTORY_GRAPH_WIDTH, HISTORY_GRAPH_HEIGHT)
+			lines = []map[string]interface{}{
+				{"points": weather.PlotPoints(series.Points, weather.MeanOf, lower, upper, HISTORY_GRAPH_WIDTH, HISTORY_GRAPH_HEIGHT), "color": template.CSS("var(--md-sys-color-tertiary)")},
+			}
+			retData["title"] = fmt.Sprintf("Last %s", rangeName)
+			retData["legend"] = "Mean"
+		}
+
+		graph, err = DrawHistoryGraph(band, lines)
+		if err != nil {
+			goto api_weatherhistory_err
+		}
+		retData["graph"] = graph
+		retData["upper"] = fmt.Sprintf(util.TEMP_FORMAT_DAY, upper)
+		retData["lower"] = fmt.Sprintf(util.TEMP_FORMAT_DAY, lower)
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_weatherhistory_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for the forecast accuracy API endpoint.
+	r.GET(util.API_ROOT_PATH+"/weather/accuracy", func(c *gin.Context) {
+		var err error
+		var stations []string
+		reports := []weather.AccuracyReport{}
+
+		if amedas_code := c.Query("amedas_code"); amedas_code != "" {
+			if !weather.ValidAmedasCode(amedas_code) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "please provide a valid amedas location code"})
+				return
+			}
+			stations = []string{amedas_code}
+		} else if stations, err = forecastTracker.Stations(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, amedas_code := range stations {
+			stationReports, err := weather.ScoreForecasts(forecastTracker, historyStore, amedas_code, time.Now())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			reports = append(reports, stationReports...)
+		}
+		c.JSON(http.StatusOK, reports)
+	})
+
+	// Handler for forecast accuracy widget API endpoint.
+	r.GET(util.API_ROOT_PATH+"/forecastaccuracy", func(c *gin.Context) {
+		var err error
+		var location_name, amedas_code string
+		var reports []weather.AccuracyReport
+		var report weather.AccuracyReport
+		var retData map[string]interface{}
+
+		// Check the query parameters for forecast accuracy request.
+		_, location_name, amedas_code, err = weather.ForecastAccuracyCheckQuery(c)
+		if err != nil {
+			goto api_forecastaccuracy_err
+		}
+
+		reports, err = weather.ScoreForecasts(forecastTracker, historyStore, amedas_code, time.Now())
+		if err != nil {
+			goto api_forecastaccuracy_err
+		}
+
+		report = weather.AccuracyReport{Provider: weather.OPEN_METEO_JMA, AmedasCode: amedas_code}
+		for _, r := range reports {
+			if r.Provider == weather.OPEN_METEO_JMA {
+				report = r
+			}
+		}
+		report.LocationName = location_name
+
+		retData = util.StructToMap(report)
+		retData["mae_desc"] = "-"
+		retData["rain_hit_rate_desc"] = "Rain hit rate -"
+		if report.Samples > 0 {
+			retData["mae_desc"] = fmt.Sprintf(util.TEMP_FORMAT_ERR, report.MAE)
+		}
+		if report.Rain.Hits+report.Rain.Misses > 0 {
+			retData["rain_hit_rate_desc"] = fmt.Sprintf("Rain hit rate %.0f%%", report.Rain.HitRate*100)
+		}
+		retData["samples_desc"] = fmt.Sprintf("%d samples", report.Samples)
+
+		c.JSON(http.StatusOK, retData)
+		return
+
+	api_forecastaccuracy_err:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	})
+
+	// Handler for the calendar annotations (holiday, rokuyō) of a day.
+	r.GET(util.API_ROOT_PATH+"/calendarday", func(c *gin.Context) {
+		day, err := jpcal.DayCheckQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, jpcal.ParseDayData(day))
+	})
+
 	// Handler for Notion calendar API endpoint.
 	r.GET(util.API_ROOT_PATH+"/notioncalendar", func(c *gin.Context) {
 		var err error
 		var size layout.WidgetSize
-		var queryResponse notion.RawQueryResponse
+		var rawEvents []notion.RawEvent
 		var calendarData notion.CalendarData
 		var buf bytes.Buffer
 		var tmpl *template.Template
@@ -166,26 +825,42 @@ func RegisterApiRoutes(r *gin.Engine) {
 			goto api_notioncalendar_err
 		}
 
+		// Parse the template for the calendar events.
+		tmpl, err = layout.Template("widgets/notioncalendar.tmpl")
+		if err != nil {
+			err = fmt.Errorf("failed to find a template for notioncalendar Widget: %v", err)
+			goto api_notioncalendar_err
+		}
+
 		if size == layout.MiddleV || size == layout.LongV {
 			retData = map[string]interface{}{
-				"today":  now.Format("January 2"),
-				"lines":  "",
-				"events": "",
+				"today":   fmt.Sprintf("%s (%s)", now.Format("January 2"), jpcal.RokuyoOf(now).Name),
+				"all_day": "",
+				"lines":   "",
+				"events":  "",
 			}
 
-			// Fetch the Notion calendar data.
-			queryResponse, err = notion.FetchCalendarData(now)
+			// Gather the events of every calendar source.
+			rawEvents, err = notion.CollectEvents(c.Request.Context(), calendarSources, now)
 			if err != nil {
 				goto api_notioncalendar_err
 			}
+			calendarData = notion.ParseCalendarData(rawEvents, size == layout.LongV)
 
-			// Parse the fetched calendar data.
-			calendarData, err = notion.ParseCalendarData(queryResponse, size == layout.LongV)
-			if err != nil {
-				goto api_notioncalendar_err
+			// All-day events, such as holidays, are listed above the timeline.
+			for _, event := range calendarData.Events {
+				if event.IsAllDay {
+					err = tmpl.ExecuteTemplate(&buf, "allday", util.StructToMap(event))
+					if err != nil {
+						err = fmt.Errorf("template execution failed for notioncalendar Widget: %v", err)
+						goto api_notioncalendar_err
+					}
+				}
 			}
+			retData["all_day"] = buf.String()
+			buf.Reset()
 
-			if len(calendarData.Events) == 0 {
+			if calendarData.NSlot == 0 {
 				goto api_notioncalendar_success
 			}
 
@@ -195,14 +870,7 @@ func RegisterApiRoutes(r *gin.Engine) {
 				goto api_notioncalendar_err
 			}
 
-			// Parse the template for the calendar events.
-			tmpl, err = template.New("eventTmpl").ParseFiles("templates/widgets/notioncalendar.tmpl")
-			if err != nil {
-				err = fmt.Errorf("failed to find a template for notioncalendar Widget: %v", err)
-				goto api_notioncalendar_err
-			}
 			// Execute the template for each calendar event.
-
 			buf.WriteString(fmt.Sprintf("<div style=\"--nslot: %d; --min-hours: %d; --max-hours: %d;\">\n", calendarData.NSlot, calendarData.MinHours, calendarData.MaxHours))
 			for _, event := range calendarData.Events {
 				if !event.IsAllDay {
@@ -220,24 +888,20 @@ func RegisterApiRoutes(r *gin.Engine) {
 			dat := now.AddDate(0, 0, 2)
 
 			retData = map[string]interface{}{
-				"tomorrow":        tomorrow.Format("January 2"),
-				"dat":             dat.Format("January 2"),
+				"tomorrow":        fmt.Sprintf("%s (%s)", tomorrow.Format("January 2"), jpcal.RokuyoOf(tomorrow).Name),
+				"dat":             fmt.Sprintf("%s (%s)", dat.Format("January 2"), jpcal.RokuyoOf(dat).Name),
 				"tomorrow_events": "",
 				"dat_events":      "",
 			}
 
 			var buf2 bytes.Buffer
 			for keyName, date := range map[string]time.Time{"tomorrow_events": tomorrow, "dat_events": dat} {
-				queryResponse, err = notion.FetchCalendarData(date)
-				if err != nil {
-					goto api_notioncalendar_err
-				}
-
-				// Parse the fetched calendar data.
-				calendarData, err = notion.ParseCalendarData(queryResponse, false)
+				// Gather the events of every calendar source.
+				rawEvents, err = notion.CollectEvents(c.Request.Context(), calendarSources, date)
 				if err != nil {
 					goto api_notioncalendar_err
 				}
+				calendarData = notion.ParseCalendarData(rawEvents, false)
 
 				if len(calendarData.Events) == 0 {
 					buf.WriteString("<span class=\"w-full\" style=\"font-size: 10%;\" >No events</span>")
@@ -245,7 +909,11 @@ func RegisterApiRoutes(r *gin.Engine) {
 
 				for _, event := range calendarData.Events {
 					if event.IsAllDay {
-						buf.WriteString(fmt.Sprintf(`<span class=\"w-full\" style=\"font-size: 10%%; background-color: var(--md-sys-color-primary-container);\" >%s</span>`, event.Name))
+						err = tmpl.ExecuteTemplate(&buf, "allday", util.StructToMap(event))
+						if err != nil {
+							err = fmt.Errorf("template execution failed for notioncalendar Widget: %v", err)
+							goto api_notioncalendar_err
+						}
 					} else {
 						buf2.WriteString(fmt.Sprintf("<div class=\"wg-hstack\" style=\"font-size: 10%%;\"><span class=\"material-symbols-outlined\" style=\"color: var(--md-sys-color-primary-container);\">circle</span><span>%s %s</span></div>", event.TimeDesc, event.Name))
 					}
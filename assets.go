@@ -0,0 +1,40 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+
+	"github.com/kken7231/screensaver/config"
+	"github.com/kken7231/screensaver/util"
+)
+
+// embeddedAssets holds the templates, static files and default layouts built into the binary.
+//
+//go:embed templates static layouts/*.json
+var embeddedAssets embed.FS
+
+// Assets represents the file systems the server reads its templates, static files and layouts from.
+type Assets struct {
+	Templates fs.FS
+	Static    fs.FS
+	Layouts   fs.FS
+}
+
+// NewAssets overlays the directories of the configuration on the embedded assets.
+func NewAssets(cfg config.Config) Assets {
+	return Assets{
+		Templates: overlayAssets(cfg.Paths.Templates, "templates"),
+		Static:    overlayAssets(cfg.Paths.Static, "static"),
+		Layouts:   overlayAssets(cfg.Paths.Layouts, "layouts"),
+	}
+}
+
+// overlayAssets returns the embedded directory dir overridden by the on-disk directory path.
+func overlayAssets(path, dir string) fs.FS {
+	embedded, err := fs.Sub(embeddedAssets, dir)
+	if err != nil {
+		log.Fatalf("Failed to find the embedded %s: %v", dir, err)
+	}
+	return util.NewOverlayFS(path, embedded)
+}
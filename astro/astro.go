@@ -0,0 +1,292 @@
+// Package astro computes the positions, rise and set times of the sun and moon and the lunar phase offline.
+// The formulas are the low-precision ones of the Astronomical Almanac, accurate to about a minute for rise and set times.
+package astro
+
+import (
+	"math"
+	"time"
+)
+
+// Altitudes of the sun center, in degrees, defining the solar events.
+const (
+	SUNRISE_ALTITUDE     = -0.833
+	CIVIL_ALTITUDE       = -6.0
+	NAUTICAL_ALTITUDE    = -12.0
+	GOLDEN_HOUR_ALTITUDE = 6.0
+)
+
+// MOONRISE_ALTITUDE is the altitude of the moon center, in degrees, at moonrise and moonset.
+const MOONRISE_ALTITUDE = 0.133
+
+// SEARCH_STEP is the step at which altitudes are sampled when searching rise and set times.
+const SEARCH_STEP = 10 * time.Minute
+
+// Constants of the low-precision ephemeris.
+const (
+	rad         = math.Pi / 180
+	julian1970  = 2440588.0
+	julian2000  = 2451545.0
+	obliquity   = rad * 23.4397
+	sunDistance = 149598000.0
+)
+
+// Position represents the horizontal coordinates of a body, in degrees.
+// The azimuth is measured clockwise from the north.
+type Position struct {
+	Altitude float64 `json:"altitude"`
+	Azimuth  float64 `json:"azimuth"`
+}
+
+// equatorial represents the equatorial coordinates of a body, in radians, and its distance in km.
+type equatorial struct {
+	rightAscension float64
+	declination    float64
+	distance       float64
+}
+
+// toDays returns the days elapsed since J2000.0.
+func toDays(t time.Time) float64 {
+	return float64(t.UnixMilli())/float64(24*time.Hour/time.Millisecond) - 0.5 + julian1970 - julian2000
+}
+
+// rightAscension converts ecliptic coordinates into a right ascension.
+func rightAscension(l, b float64) float64 {
+	return math.Atan2(math.Sin(l)*math.Cos(obliquity)-math.Tan(b)*math.Sin(obliquity), math.Cos(l))
+}
+
+// declination converts ecliptic coordinates into a declination.
+func declination(l, b float64) float64 {
+	return math.Asin(math.Sin(b)*math.Cos(obliquity) + math.Cos(b)*math.Sin(obliquity)*math.Sin(l))
+}
+
+// siderealTime returns the local sidereal time at the west longitude lw.
+func siderealTime(d, lw float64) float64 {
+	return rad*(280.16+360.9856235*d) - lw
+}
+
+// horizontal converts equatorial coordinates into the horizontal coordinates seen from the location.
+func horizontal(c equatorial, d, latitude, longitude float64) Position {
+	phi := rad * latitude
+	h := siderealTime(d, rad*-longitude) - c.rightAscension
+	altitude := math.Asin(math.Sin(phi)*math.Sin(c.declination) + math.Cos(phi)*math.Cos(c.declination)*math.Cos(h))
+	azimuth := math.Atan2(math.Sin(h), math.Cos(h)*math.Sin(phi)-math.Tan(c.declination)*math.Cos(phi))
+	return Position{
+		Altitude: altitude / rad,
+		Azimuth:  math.Mod(azimuth/rad+180, 360),
+	}
+}
+
+// sunCoords returns the equatorial coordinates of the sun.
+func sunCoords(d float64) equatorial {
+	m := rad * (357.5291 + 0.98560028*d)
+	center := rad * (1.9148*math.Sin(m) + 0.02*math.Sin(2*m) + 0.0003*math.Sin(3*m))
+	l := m + center + rad*102.9372 + math.Pi
+	return equatorial{
+		rightAscension: rightAscension(l, 0),
+		declination:    declination(l, 0),
+		distance:       sunDistance,
+	}
+}
+
+// moonCoords returns the geocentric equatorial coordinates of the moon.
+func moonCoords(d float64) equatorial {
+	meanLongitude := rad * (218.316 + 13.176396*d)
+	meanAnomaly := rad * (134.963 + 13.064993*d)
+	meanDistance := rad * (93.272 + 13.229350*d)
+	l := meanLongitude + rad*6.289*math.Sin(meanAnomaly)
+	b := rad * 5.128 * math.Sin(meanDistance)
+	return equatorial{
+		rightAscension: rightAscension(l, b),
+		declination:    declination(l, b),
+		distance:       385001 - 20905*math.Cos(meanAnomaly),
+	}
+}
+
+// SunPosition returns the position of the sun seen from the location at t.
+func SunPosition(t time.Time, latitude, longitude float64) Position {
+	d := toDays(t)
+	return horizontal(sunCoords(d), d, latitude, longitude)
+}
+
+// MoonPosition returns the position of the moon seen from the location at t, corrected for refraction.
+func MoonPosition(t time.Time, latitude, longitude float64) Position {
+	d := toDays(t)
+	position := horizontal(moonCoords(d), d, latitude, longitude)
+	// Atmospheric refraction (Sæmundsson), valid above about -1°.
+	altitude := math.Max(position.Altitude, 0)
+	position.Altitude += 0.017 / math.Tan(rad*(altitude+10.26/(altitude+5.10)))
+	return position
+}
+
+// Crossing represents a time at which a body crosses an altitude.
+type Crossing struct {
+	Time   time.Time
+	Rising bool
+}
+
+// findCrossings finds the times at which altitude crosses threshold between from and to.
+// Altitudes are sampled every SEARCH_STEP and each crossing is refined by bisection.
+func findCrossings(altitude func(time.Time) float64, threshold float64, from, to time.Time) []Crossing {
+	var crossings []Crossing
+	prevTime := from
+	prevValue := altitude(from) - threshold
+	for t := from.Add(SEARCH_STEP); !t.After(to); t = t.Add(SEARCH_STEP) {
+		value := altitude(t) - threshold
+		if (prevValue < 0) != (value < 0) {
+			lower, upper := prevTime, t
+			for upper.Sub(lower) > time.Second {
+				middle := lower.Add(upper.Sub(lower) / 2)
+				if (altitude(middle)-threshold < 0) == (prevValue < 0) {
+					lower = middle
+				} else {
+					upper = middle
+				}
+			}
+			crossings = append(crossings, Crossing{Time: upper.Truncate(time.Second), Rising: prevValue < 0})
+		}
+		prevTime, prevValue = t, value
+	}
+	return crossings
+}
+
+// dayBounds returns the start and end of the local day of t in its location.
+func dayBounds(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// riseAndSet returns the first rising and setting crossings of the altitude during the local day of t.
+// Times are zero when the event does not occur that day, e.g. during polar day or night.
+func riseAndSet(altitude func(time.Time) float64, threshold float64, day time.Time) (time.Time, time.Time) {
+	var rise, set time.Time
+	start, end := dayBounds(day)
+	for _, crossing := range findCrossings(altitude, threshold, start, end) {
+		if crossing.Rising && rise.IsZero() {
+			rise = crossing.Time
+		} else if !crossing.Rising && set.IsZero() {
+			set = crossing.Time
+		}
+	}
+	return rise, set
+}
+
+// SunTimes represents the solar events of a day. Events that do not occur that day are zero.
+type SunTimes struct {
+	NauticalDawn  time.Time `json:"nautical_dawn"`
+	CivilDawn     time.Time `json:"civil_dawn"`
+	Sunrise       time.Time `json:"sunrise"`
+	GoldenHourEnd time.Time `json:"golden_hour_end"`
+	SolarNoon     time.Time `json:"solar_noon"`
+	GoldenHour    time.Time `json:"golden_hour"`
+	Sunset        time.Time `json:"sunset"`
+	CivilDusk     time.Time `json:"civil_dusk"`
+	NauticalDusk  time.Time `json:"nautical_dusk"`
+}
+
+// GetSunTimes returns the solar events of the local day of t, seen from the location.
+func GetSunTimes(day time.Time, latitude, longitude float64) SunTimes {
+	var times SunTimes
+	altitude := func(t time.Time) float64 {
+		return SunPosition(t, latitude, longitude).Altitude
+	}
+	times.NauticalDawn, times.NauticalDusk = riseAndSet(altitude, NAUTICAL_ALTITUDE, day)
+	times.CivilDawn, times.CivilDusk = riseAndSet(altitude, CIVIL_ALTITUDE, day)
+	times.Sunrise, times.Sunset = riseAndSet(altitude, SUNRISE_ALTITUDE, day)
+	times.GoldenHourEnd, times.GoldenHour = riseAndSet(altitude, GOLDEN_HOUR_ALTITUDE, day)
+
+	// The solar noon is the transit, where the sun is the highest.
+	start, end := dayBounds(day)
+	highest := math.Inf(-1)
+	for t := start; t.Before(end); t = t.Add(time.Minute) {
+		if a := altitude(t); a > highest {
+			highest = a
+			times.SolarNoon = t
+		}
+	}
+	return times
+}
+
+// MoonTimes represents the moonrise and moonset of a day. Events that do not occur that day are zero.
+type MoonTimes struct {
+	Rise time.Time `json:"rise"`
+	Set  time.Time `json:"set"`
+}
+
+// GetMoonTimes returns the moonrise and moonset of the local day of t, seen from the location.
+func GetMoonTimes(day time.Time, latitude, longitude float64) MoonTimes {
+	var times MoonTimes
+	times.Rise, times.Set = riseAndSet(func(t time.Time) float64 {
+		return MoonPosition(t, latitude, longitude).Altitude
+	}, MOONRISE_ALTITUDE, day)
+	return times
+}
+
+// MoonIllumination represents the illuminated fraction and phase of the moon.
+// The phase goes from 0 (new moon) through 0.25 (first quarter), 0.5 (full moon) and 0.75 (last quarter) back to 1.
+type MoonIllumination struct {
+	Fraction float64 `json:"fraction"`
+	Phase    float64 `json:"phase"`
+}
+
+// GetMoonIllumination returns the illumination of the moon at t.
+func GetMoonIllumination(t time.Time) MoonIllumination {
+	d := toDays(t)
+	sun := sunCoords(d)
+	moon := moonCoords(d)
+
+	elongation := math.Acos(math.Sin(sun.declination)*math.Sin(moon.declination) +
+		math.Cos(sun.declination)*math.Cos(moon.declination)*math.Cos(sun.rightAscension-moon.rightAscension))
+	inclination := math.Atan2(sun.distance*math.Sin(elongation), moon.distance-sun.distance*math.Cos(elongation))
+	angle := math.Atan2(math.Cos(sun.declination)*math.Sin(sun.rightAscension-moon.rightAscension),
+		math.Sin(sun.declination)*math.Cos(moon.declination)-math.Cos(sun.declination)*math.Sin(moon.declination)*math.Cos(sun.rightAscension-moon.rightAscension))
+
+	sign := 1.0
+	if angle < 0 {
+		sign = -1
+	}
+	return MoonIllumination{
+		Fraction: (1 + math.Cos(inclination)) / 2,
+		Phase:    0.5 + 0.5*inclination*sign/math.Pi,
+	}
+}
+
+// MoonPhase represents a named phase of the moon.
+type MoonPhase struct {
+	Name   string
+	NameJP string
+	Icon   string
+}
+
+// moonPhases are the eight named phases, starting from the new moon.
+var moonPhases = []MoonPhase{
+	{"New Moon", "新月", "🌑"},
+	{"Waxing Crescent", "三日月", "🌒"},
+	{"First Quarter", "上弦の月", "🌓"},
+	{"Waxing Gibbous", "十三夜", "🌔"},
+	{"Full Moon", "満月", "🌕"},
+	{"Waning Gibbous", "寝待月", "🌖"},
+	{"Last Quarter", "下弦の月", "🌗"},
+	{"Waning Crescent", "有明月", "🌘"},
+}
+
+// GetMoonPhase returns the named phase of a phase value between 0 and 1.
+func GetMoonPhase(phase float64) MoonPhase {
+	return moonPhases[int(math.Round(phase*8))%8]
+}
+
+// IsDark reports whether the sun is below the horizon at the location at t.
+func IsDark(t time.Time, latitude, longitude float64) bool {
+	return SunPosition(t, latitude, longitude).Altitude < SUNRISE_ALTITUDE
+}
+
+// NextLightChange returns the next time after t at which the sun rises or sets at the location,
+// searching up to two days ahead. It is zero when there is none, e.g. during polar day or night.
+func NextLightChange(t time.Time, latitude, longitude float64) time.Time {
+	crossings := findCrossings(func(t time.Time) float64 {
+		return SunPosition(t, latitude, longitude).Altitude
+	}, SUNRISE_ALTITUDE, t, t.AddDate(0, 0, 2))
+	if len(crossings) == 0 {
+		return time.Time{}
+	}
+	return crossings[0].Time
+}
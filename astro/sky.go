@@ -0,0 +1,166 @@
+// Package astro computes the positions, rise and set times of the sun and moon and the lunar phase offline.
+package astro
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SkyData represents the sun and moon of a day for display.
+type SkyData struct {
+	NauticalDawn     string `json:"nautical_dawn"`
+	CivilDawn        string `json:"civil_dawn"`
+	Sunrise          string `json:"sunrise"`
+	GoldenHourEnd    string `json:"golden_hour_end"`
+	SolarNoon        string `json:"solar_noon"`
+	GoldenHour       string `json:"golden_hour"`
+	Sunset           string `json:"sunset"`
+	CivilDusk        string `json:"civil_dusk"`
+	NauticalDusk     string `json:"nautical_dusk"`
+	DayLength        string `json:"day_length"`
+	SunAltitude      string `json:"sun_altitude"`
+	SunAzimuth       string `json:"sun_azimuth"`
+	Moonrise         string `json:"moonrise"`
+	Moonset          string `json:"moonset"`
+	MoonPhase        string `json:"moon_phase"`
+	MoonPhaseJP      string `json:"moon_phase_jp"`
+	MoonIcon         string `json:"moon_icon"`
+	MoonIllumination string `json:"moon_illumination"`
+	Dark             bool   `json:"dark"`
+}
+
+// ThemeData represents the color scheme to display at a location and when it changes next.
+type ThemeData struct {
+	Dark         bool `json:"dark"`
+	NextChangeIn int  `json:"next_change_in"`
+}
+
+// formatEvent formats the time of an event in the location, or returns "-" when it does not occur.
+func formatEvent(t time.Time, location *time.Location) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(location).Format("15:04")
+}
+
+// ParseSkyData computes the sun and moon of the day of now at the location for display.
+func ParseSkyData(now time.Time, latitude, longitude float64) SkyData {
+	sunTimes := GetSunTimes(now, latitude, longitude)
+	moonTimes := GetMoonTimes(now, latitude, longitude)
+	sunPosition := SunPosition(now, latitude, longitude)
+	illumination := GetMoonIllumination(now)
+	phase := GetMoonPhase(illumination.Phase)
+	location := now.Location()
+
+	dayLength := "-"
+	if !sunTimes.Sunrise.IsZero() && !sunTimes.Sunset.IsZero() && sunTimes.Sunset.After(sunTimes.Sunrise) {
+		length := sunTimes.Sunset.Sub(sunTimes.Sunrise)
+		dayLength = fmt.Sprintf("%dh %02dm", int(length.Hours()), int(length.Minutes())%60)
+	}
+
+	return SkyData{
+		NauticalDawn:     formatEvent(sunTimes.NauticalDawn, location),
+		CivilDawn:        formatEvent(sunTimes.CivilDawn, location),
+		Sunrise:          formatEvent(sunTimes.Sunrise, location),
+		GoldenHourEnd:    formatEvent(sunTimes.GoldenHourEnd, location),
+		SolarNoon:        formatEvent(sunTimes.SolarNoon, location),
+		GoldenHour:       formatEvent(sunTimes.GoldenHour, location),
+		Sunset:           formatEvent(sunTimes.Sunset, location),
+		CivilDusk:        formatEvent(sunTimes.CivilDusk, location),
+		NauticalDusk:     formatEvent(sunTimes.NauticalDusk, location),
+		DayLength:        dayLength,
+		SunAltitude:      fmt.Sprintf("%.0f°", sunPosition.Altitude),
+		SunAzimuth:       fmt.Sprintf("%.0f°", sunPosition.Azimuth),
+		Moonrise:         formatEvent(moonTimes.Rise, location),
+		Moonset:          formatEvent(moonTimes.Set, location),
+		MoonPhase:        phase.Name,
+		MoonPhaseJP:      phase.NameJP,
+		MoonIcon:         phase.Icon,
+		MoonIllumination: fmt.Sprintf("%.0f%%", illumination.Fraction*100),
+		Dark:             sunPosition.Altitude < SUNRISE_ALTITUDE,
+	}
+}
+
+// GetThemeData returns whether to display the dark theme at the location and in how many seconds it changes.
+// Without a sunrise or sunset in the next two days, the theme is checked again in an hour.
+func GetThemeData(now time.Time, latitude, longitude float64) ThemeData {
+	nextChangeIn := int(time.Hour.Seconds())
+	if next := NextLightChange(now, latitude, longitude); !next.IsZero() {
+		nextChangeIn = int(math.Ceil(next.Sub(now).Seconds()))
+	}
+	return ThemeData{
+		Dark:         IsDark(now, latitude, longitude),
+		NextChangeIn: nextChangeIn,
+	}
+}
+
+// parseCoordinates parses the latitude and longitude query parameters.
+func parseCoordinates(c *gin.Context) (float64, float64, error) {
+	latitude_str := c.Query("location_latitude")
+	longitude_str := c.Query("location_longitude")
+	if latitude_str == "" || longitude_str == "" {
+		return 0, 0, fmt.Errorf("please provide location information")
+	}
+	latitude, err := strconv.ParseFloat(latitude_str, 64)
+	if err != nil || math.Abs(latitude) > 90 {
+		return 0, 0, fmt.Errorf("please provide valid latitude information")
+	}
+	longitude, err := strconv.ParseFloat(longitude_str, 64)
+	if err != nil || math.Abs(longitude) > 180 {
+		return 0, 0, fmt.Errorf("please provide valid longitude information")
+	}
+	return latitude, longitude, nil
+}
+
+// SkyCheckQuery checks and validates query parameters for sky requests.
+// The time zone defaults to the one of the server.
+func SkyCheckQuery(c *gin.Context) (layout.WidgetSize, string, float64, float64, *time.Location, error) {
+	var latitude, longitude float64
+	var location *time.Location
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	timezone := c.Query("location_timezone")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto sky_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.SkyWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto sky_checkquery_finish
+	}
+
+	if location_name == "" {
+		err = fmt.Errorf("please provide location information")
+		goto sky_checkquery_finish
+	}
+	latitude, longitude, err = parseCoordinates(c)
+	if err != nil {
+		goto sky_checkquery_finish
+	}
+
+	location = time.Local
+	if timezone != "" {
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			err = fmt.Errorf("invalid time zone \"%s\"", timezone)
+			goto sky_checkquery_finish
+		}
+	}
+
+sky_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, latitude, longitude, location, err
+}
+
+// ThemeCheckQuery checks and validates query parameters for theme requests.
+func ThemeCheckQuery(c *gin.Context) (float64, float64, error) {
+	return parseCoordinates(c)
+}
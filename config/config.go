@@ -0,0 +1,291 @@
+// Package config loads the settings of the application from a TOML file, environment variables and flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// DEFAULT_CONFIG_PATH is the configuration file read when no -config flag is given.
+const DEFAULT_CONFIG_PATH = "config/screensaver.toml"
+
+// ENV_PREFIX prefixes the environment variables overriding the settings, e.g. SCREENSAVER_SERVER_PORT.
+const ENV_PREFIX = "SCREENSAVER_"
+
+// ServerConfig represents the settings of the HTTP server.
+type ServerConfig struct {
+	Port int `toml:"port"`
+}
+
+// PathsConfig represents the directories the application reads and writes.
+type PathsConfig struct {
+	Templates string `toml:"templates"`
+	Static    string `toml:"static"`
+	Layouts   string `toml:"layouts"`
+	Data      string `toml:"data"`
+	Secrets   string `toml:"secrets"`
+}
+
+// NotionConfig represents the Notion database of the calendar.
+// The API key is not written in the configuration but referenced by the name of its secret.
+type NotionConfig struct {
+	DatabaseID       string `toml:"database_id"`
+	APIKeySecret     string `toml:"api_key_secret"`
+	NameProperty     string `toml:"name_property"`
+	DateProperty     string `toml:"date_property"`
+	CategoryProperty string `toml:"category_property"`
+	CategoryValue    string `toml:"category_value"`
+
+	// APIKey is resolved from APIKeySecret when the configuration is loaded.
+	APIKey string `toml:"-"`
+}
+
+// Enabled reports whether a Notion database is configured.
+func (c NotionConfig) Enabled() bool {
+	return c.DatabaseID != ""
+}
+
+// WeatherConfig represents the settings of the weather data.
+type WeatherConfig struct {
+	AdviceRules string `toml:"advice_rules"`
+}
+
+// DisplayConfig represents the appearance shared by every layout.
+type DisplayConfig struct {
+	Gap            string `toml:"gap"`
+	Margin         string `toml:"margin"`
+	ThemeSeedColor string `toml:"theme_seed_color"`
+}
+
+// ScheduleConfig represents the schedules switching the layouts of the displays.
+type ScheduleConfig struct {
+	Rules string `toml:"rules"`
+}
+
+// AdminConfig represents the access to the admin API.
+// Without a token, the admin API is disabled.
+type AdminConfig struct {
+	TokenSecret string `toml:"token_secret"`
+
+	// Token is resolved from TokenSecret when the configuration is loaded, empty when the secret is not set.
+	Token string `toml:"-"`
+}
+
+// Config represents the settings of the application.
+type Config struct {
+	Server   ServerConfig   `toml:"server"`
+	Paths    PathsConfig    `toml:"paths"`
+	Notion   NotionConfig   `toml:"notion"`
+	Weather  WeatherConfig  `toml:"weather"`
+	Display  DisplayConfig  `toml:"display"`
+	Schedule ScheduleConfig `toml:"schedule"`
+	Admin    AdminConfig    `toml:"admin"`
+}
+
+// Default returns the settings used when nothing is configured.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port: 8080,
+		},
+		Paths: PathsConfig{
+			Templates: "templates",
+			Static:    "static",
+			Layouts:   "layouts",
+			Data:      "data",
+			Secrets:   "secrets",
+		},
+		Notion: NotionConfig{
+			APIKeySecret:     "NOTION_API_KEY",
+			NameProperty:     "名前",
+			DateProperty:     "日付",
+			CategoryProperty: "カテゴリ",
+			CategoryValue:    "EV",
+		},
+		Weather: WeatherConfig{
+			AdviceRules: "config/advice.json",
+		},
+		Display: DisplayConfig{
+			Gap:            "16px",
+			Margin:         "16px",
+			ThemeSeedColor: "#f82506",
+		},
+		Schedule: ScheduleConfig{
+			Rules: "config/schedule.json",
+		},
+		Admin: AdminConfig{
+			TokenSecret: "ADMIN_TOKEN",
+		},
+	}
+}
+
+// setting represents a string or integer field of the configuration, named "section.key".
+type setting struct {
+	name  string
+	value reflect.Value
+}
+
+// settings lists the fields of the configuration that can be overridden.
+func (c *Config) settings() []setting {
+	var list []setting
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("toml")
+		for j := 0; j < section.NumField(); j++ {
+			key := section.Type().Field(j).Tag.Get("toml")
+			if key == "-" {
+				continue
+			}
+			list = append(list, setting{name: sectionName + "." + key, value: section.Field(j)})
+		}
+	}
+	return list
+}
+
+// set parses the string into the field of the setting.
+func (s setting) set(value string) error {
+	switch s.value.Kind() {
+	case reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer: %s", s.name, value)
+		}
+		s.value.SetInt(int64(number))
+	default:
+		s.value.SetString(value)
+	}
+	return nil
+}
+
+// envName returns the environment variable overriding the setting.
+func (s setting) envName() string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(s.name, ".", "_"))
+}
+
+// Load reads the settings from the configuration file, then applies the environment variables and
+// the command-line flags (e.g. -server.port 8081) in this order, resolves the secrets and validates the result.
+// A missing file is only an error when it was given with -config.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("screensaver", flag.ContinueOnError)
+	path := flags.String("config", DEFAULT_CONFIG_PATH, "configuration file")
+	overrides := map[string]*string{}
+	for _, s := range cfg.settings() {
+		overrides[s.name] = flags.String(s.name, "", fmt.Sprintf("overrides %s (env %s)", s.name, s.envName()))
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+	explicit := false
+	flags.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "config"
+	})
+
+	data, err := os.ReadFile(*path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		data = nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("failed to read the configuration %s: %v", *path, err)
+	}
+	if err = toml.NewDecoder(strings.NewReader(string(data))).DisallowUnknownFields().Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse the configuration %s: %v", *path, err)
+	}
+
+	for _, s := range cfg.settings() {
+		if value, ok := os.LookupEnv(s.envName()); ok {
+			if err = s.set(value); err != nil {
+				return cfg, err
+			}
+		}
+	}
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range cfg.settings() {
+			if s.name == f.Name && flagErr == nil {
+				flagErr = s.set(*overrides[s.name])
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, flagErr
+	}
+
+	if cfg.Notion.Enabled() {
+		cfg.Notion.APIKey, err = cfg.Secret(cfg.Notion.APIKeySecret)
+		if err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Admin.TokenSecret != "" {
+		// The admin token is optional, so a missing secret only disables the admin API.
+		cfg.Admin.Token, _ = cfg.Secret(cfg.Admin.TokenSecret)
+	}
+	return cfg, cfg.Validate()
+}
+
+// secretNamePattern matches the names of secrets, which are also environment variable and file names.
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Secret resolves a secret by name, from the environment variable of that name
+// or else from the file of that name in the secrets directory.
+func (c Config) Secret(name string) (string, error) {
+	if !secretNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid secret name \"%s\"", name)
+	}
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(filepath.Join(c.Paths.Secrets, name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s is neither in the environment nor in %s", name, c.Paths.Secrets)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Patterns of the CSS lengths and colors accepted in the display settings.
+var (
+	cssLengthPattern = regexp.MustCompile(`^(0|[0-9]+(\.[0-9]+)?(px|em|rem|vh|vw|vmin|vmax|%))$`)
+	hexColorPattern  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// Validate checks the settings, so that a misconfiguration stops the application at startup.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535: %d", c.Server.Port))
+	}
+	// The directories only override the embedded files, so they may be missing but not be files.
+	for name, dir := range map[string]string{"paths.templates": c.Paths.Templates, "paths.static": c.Paths.Static, "paths.layouts": c.Paths.Layouts} {
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s is not a directory: %s", name, dir))
+		}
+	}
+	if c.Paths.Data == "" {
+		errs = append(errs, fmt.Errorf("paths.data must not be empty"))
+	}
+	if c.Notion.Enabled() && (c.Notion.NameProperty == "" || c.Notion.DateProperty == "") {
+		errs = append(errs, fmt.Errorf("notion.name_property and notion.date_property must not be empty"))
+	}
+	if !cssLengthPattern.MatchString(c.Display.Gap) {
+		errs = append(errs, fmt.Errorf("display.gap must be a CSS length: %s", c.Display.Gap))
+	}
+	if !cssLengthPattern.MatchString(c.Display.Margin) {
+		errs = append(errs, fmt.Errorf("display.margin must be a CSS length: %s", c.Display.Margin))
+	}
+	if !hexColorPattern.MatchString(c.Display.ThemeSeedColor) {
+		errs = append(errs, fmt.Errorf("display.theme_seed_color must be a color like #f82506: %s", c.Display.ThemeSeedColor))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package display
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Actions of the commands sent to the displays.
+const (
+	COMMAND_LAYOUT  = "layout"
+	COMMAND_RELOAD  = "reload"
+	COMMAND_MESSAGE = "message"
+	COMMAND_DIM     = "dim"
+	COMMAND_BLANK   = "blank"
+)
+
+// MIN_BRIGHTNESS is the lowest brightness of a dimmed display; blank it to turn it black.
+const MIN_BRIGHTNESS = 0.05
+
+// Command represents an instruction for a display:
+// "layout" switches to Layout, "reload" reloads the page,
+// "message" shows Title and Message for Duration seconds (until touched when 0),
+// "dim" sets the Brightness from MIN_BRIGHTNESS to 1 and "blank" turns the screen black or back on.
+type Command struct {
+	Action     string   `json:"action"`
+	Layout     string   `json:"layout,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Message    string   `json:"message,omitempty"`
+	Duration   int      `json:"duration,omitempty"`
+	Brightness *float64 `json:"brightness,omitempty"`
+	Blank      *bool    `json:"blank,omitempty"`
+}
+
+// Validate checks that the command has the fields of its action.
+func (c Command) Validate() error {
+	switch c.Action {
+	case COMMAND_LAYOUT:
+		if c.Layout == "" {
+			return fmt.Errorf("layout commands need a layout")
+		}
+	case COMMAND_RELOAD:
+	case COMMAND_MESSAGE:
+		if c.Message == "" {
+			return fmt.Errorf("message commands need a message")
+		}
+		if c.Duration < 0 {
+			return fmt.Errorf("invalid message duration %d", c.Duration)
+		}
+	case COMMAND_DIM:
+		if c.Brightness == nil || *c.Brightness < MIN_BRIGHTNESS || *c.Brightness > 1 {
+			return fmt.Errorf("dim commands need a brightness from %.2f to 1", MIN_BRIGHTNESS)
+		}
+	case COMMAND_BLANK:
+		if c.Blank == nil {
+			return fmt.Errorf("blank commands need blank set to true or false")
+		}
+	default:
+		return fmt.Errorf("invalid command action \"%s\"", c.Action)
+	}
+	return nil
+}
+
+// Persistent reports whether the command changes the state kept for the next connections of the display.
+func (c Command) Persistent() bool {
+	return slices.Contains([]string{COMMAND_LAYOUT, COMMAND_DIM, COMMAND_BLANK}, c.Action)
+}
+
+// StateCommands returns the commands restoring the brightness and blanking of the display on a new connection.
+func (d Display) StateCommands() []Command {
+	var commands []Command
+	if d.Brightness != 1 && d.Brightness != 0 {
+		brightness := d.Brightness
+		commands = append(commands, Command{Action: COMMAND_DIM, Brightness: &brightness})
+	}
+	if d.Blank {
+		blank := true
+		commands = append(commands, Command{Action: COMMAND_BLANK, Blank: &blank})
+	}
+	return commands
+}
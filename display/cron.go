@@ -0,0 +1,185 @@
+package display
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CRON_SEARCH_DAYS is how far Last and Next look for a firing time.
+const CRON_SEARCH_DAYS = 366
+
+// Names accepted in the month and day-of-week fields.
+var (
+	cronMonthNames   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronWeekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Cron represents a cron expression of five fields: minute, hour, day of month, month and day of week.
+// Each field accepts "*", numbers, ranges ("1-5"), lists ("1,3") and steps ("*/15"); the months and days of week
+// also accept their English abbreviations ("mon-fri"), and Sunday is either 0 or 7.
+// As in cron, a day matches either field when both the day of month and the day of week are restricted,
+// a field starting with "*" (such as "*/2") being unrestricted.
+type Cron struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// parseCronField parses a field of a cron expression into a bit mask of the values from min to max.
+func parseCronField(field string, min, max int, names []string, nameOffset int) (uint64, error) {
+	var mask uint64
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return i + nameOffset, nil
+			}
+		}
+		return strconv.Atoi(s)
+	}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step \"%s\"", part)
+			}
+		}
+		from, to := min, max
+		if rangePart != "*" {
+			fromPart, toPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = value(fromPart); err != nil {
+				return 0, fmt.Errorf("invalid value \"%s\"", part)
+			}
+			to = from
+			if isRange {
+				if to, err = value(toPart); err != nil {
+					return 0, fmt.Errorf("invalid value \"%s\"", part)
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("\"%s\" is out of the range %d-%d", part, min, max)
+		}
+		for v := from; v <= to; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+// ParseCron parses a cron expression of five fields.
+func ParseCron(expr string) (Cron, error) {
+	var c Cron
+	var err error
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("cron expression \"%s\" needs 5 fields", expr)
+	}
+	if c.minutes, err = parseCronField(fields[0], 0, 59, nil, 0); err != nil {
+		return c, fmt.Errorf("minute of \"%s\": %v", expr, err)
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23, nil, 0); err != nil {
+		return c, fmt.Errorf("hour of \"%s\": %v", expr, err)
+	}
+	if c.days, err = parseCronField(fields[2], 1, 31, nil, 0); err != nil {
+		return c, fmt.Errorf("day of month of \"%s\": %v", expr, err)
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12, cronMonthNames, 1); err != nil {
+		return c, fmt.Errorf("month of \"%s\": %v", expr, err)
+	}
+	if c.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames, 0); err != nil {
+		return c, fmt.Errorf("day of week of \"%s\": %v", expr, err)
+	}
+	// Sunday is both 0 and 7.
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	c.daysRestricted = !strings.HasPrefix(fields[2], "*")
+	c.weekdaysRestricted = !strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// matchesDay reports whether the expression fires on the day of t.
+func (c Cron) matchesDay(t time.Time) bool {
+	if c.months&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	day := c.days&(1<<t.Day()) != 0
+	weekday := c.weekdays&(1<<int(t.Weekday())) != 0
+	if c.daysRestricted && c.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Last returns the latest firing time at or before t, on a day accepted by dayFilter.
+func (c Cron) Last(t time.Time, dayFilter func(time.Time) bool) (time.Time, bool) {
+	for i := 0; i <= CRON_SEARCH_DAYS; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()-i, 0, 0, 0, 0, t.Location())
+		if !c.matchesDay(day) || !dayFilter(day) {
+			continue
+		}
+		lastHour, lastMinute := 23, 59
+		if i == 0 {
+			lastHour = t.Hour()
+		}
+		for h := lastHour; h >= 0; h-- {
+			if c.hours&(1<<h) == 0 {
+				continue
+			}
+			if i == 0 && h == t.Hour() {
+				lastMinute = t.Minute()
+			} else {
+				lastMinute = 59
+			}
+			for m := lastMinute; m >= 0; m-- {
+				if c.minutes&(1<<m) != 0 {
+					return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, t.Location()), true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Next returns the earliest firing time after t, on a day accepted by dayFilter.
+func (c Cron) Next(t time.Time, dayFilter func(time.Time) bool) (time.Time, bool) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i <= CRON_SEARCH_DAYS; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+i, 0, 0, 0, 0, t.Location())
+		if !c.matchesDay(day) || !dayFilter(day) {
+			continue
+		}
+		firstHour, firstMinute := 0, 0
+		if i == 0 {
+			firstHour = t.Hour()
+		}
+		for h := firstHour; h <= 23; h++ {
+			if c.hours&(1<<h) == 0 {
+				continue
+			}
+			if i == 0 && h == t.Hour() {
+				firstMinute = t.Minute()
+			} else {
+				firstMinute = 0
+			}
+			for m := firstMinute; m <= 59; m++ {
+				if c.minutes&(1<<m) != 0 {
+					return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, t.Location()), true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
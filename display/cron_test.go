@@ -0,0 +1,69 @@
+package display
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "30 6 * * mon-fri"},
+		{expr: "*/15 8-18 1,15 jan-jun 0"},
+		{expr: "0 0 * * 7"},
+		{expr: "0 9 */2 * sun"},
+		{expr: "0 6 * *", wantErr: true},
+		{expr: "60 6 * * *", wantErr: true},
+		{expr: "0 24 * * *", wantErr: true},
+		{expr: "0 6 0 * *", wantErr: true},
+		{expr: "0 6 * 13 *", wantErr: true},
+		{expr: "0 6 * * 8", wantErr: true},
+		{expr: "0 6 * * fri-mon", wantErr: true},
+		{expr: "*/0 6 * * *", wantErr: true},
+		{expr: "0 6 * * someday", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCron(%q) returned %v, want an error: %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	anyDay := func(time.Time) bool { return true }
+	// 2024-06-03 is a Monday.
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{name: "later the same day", expr: "30 6 * * *", from: "2024-06-03 05:00", want: "2024-06-03 06:30"},
+		{name: "strictly after", expr: "30 6 * * *", from: "2024-06-03 06:30", want: "2024-06-04 06:30"},
+		{name: "steps of minutes", expr: "*/15 * * * *", from: "2024-06-03 10:07", want: "2024-06-03 10:15"},
+		{name: "weekdays skip the weekend", expr: "0 9 * * mon-fri", from: "2024-06-07 10:00", want: "2024-06-10 09:00"},
+		{name: "Sunday as 7", expr: "0 8 * * 7", from: "2024-06-03 00:00", want: "2024-06-09 08:00"},
+		{name: "day of month", expr: "0 0 15 * *", from: "2024-06-16 00:00", want: "2024-07-15 00:00"},
+		{name: "month names", expr: "0 0 1 jan *", from: "2024-06-03 00:00", want: "2025-01-01 00:00"},
+		{name: "either restricted day", expr: "0 12 1 * mon", from: "2024-06-04 00:00", want: "2024-06-10 12:00"},
+		{name: "starred day of month is unrestricted", expr: "0 12 */2 * mon", from: "2024-06-04 00:00", want: "2024-06-17 12:00"},
+		{name: "starred day of week is unrestricted", expr: "0 12 10 * */2", from: "2024-06-04 00:00", want: "2024-08-10 12:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, _ := time.Parse("2006-01-02 15:04", tt.from)
+			want, _ := time.Parse("2006-01-02 15:04", tt.want)
+			got, ok := c.Next(from, anyDay)
+			if !ok || !got.Equal(want) {
+				t.Errorf("Next(%s) of %q = %s, want %s", tt.from, tt.expr, got.Format("2006-01-02 15:04"), tt.want)
+			}
+		})
+	}
+}
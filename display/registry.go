@@ -0,0 +1,379 @@
+// Package display keeps track of the displays showing the layouts and sends them commands.
+package display
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kken7231/screensaver/util"
+)
+
+// CLIENT_COOKIE is the cookie holding the client ID of a display.
+const CLIENT_COOKIE = "screensaver_client"
+
+// CLIENT_COOKIE_MAX_AGE is the lifetime of the client cookie in seconds, renewed on every page load.
+const CLIENT_COOKIE_MAX_AGE = 400 * 24 * 60 * 60
+
+// CLIENT_KEY_FILE is the file next to the displays holding the key signing the client cookies.
+const CLIENT_KEY_FILE = "client.key"
+
+// MAX_DISPLAYS is the most displays the registry keeps; new displays are refused beyond it.
+const MAX_DISPLAYS = 64
+
+// DISPLAY_RETENTION is how long a disconnected display without an assigned layout is kept.
+const DISPLAY_RETENTION = 30 * 24 * time.Hour
+
+// COMMAND_EVENT is the event of the push channel carrying the commands to a display.
+const COMMAND_EVENT = "command"
+
+// ErrUnknownDisplay is returned for a client ID that never connected.
+var ErrUnknownDisplay = errors.New("unknown display")
+
+// ErrTooManyDisplays is returned when a new display connects to a full registry.
+var ErrTooManyDisplays = errors.New("too many displays")
+
+// clientIdPattern matches the client IDs issued by the server.
+var clientIdPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Display represents a display known to the server. Layout is the layout assigned by the admin API,
+// which the display shows instead of the one of its URL; Showing is the layout it last reported.
+type Display struct {
+	ID         string    `json:"id"`
+	Layout     string    `json:"layout"`
+	Showing    string    `json:"showing"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	LastSeen   time.Time `json:"last_seen"`
+	Connected  bool      `json:"connected"`
+	Brightness float64   `json:"brightness"`
+	Blank      bool      `json:"blank"`
+}
+
+// Registry keeps the displays in a JSON file, so that their assigned layouts survive restarts and reboots.
+type Registry struct {
+	path        string
+	key         []byte
+	mu          sync.Mutex
+	displays    map[string]*Display
+	channels    map[string]map[chan util.Message]struct{}
+	connections chan string
+}
+
+// NewRegistry creates a registry persisting the displays in the file at path.
+func NewRegistry(path string) *Registry {
+	r := &Registry{
+		path:        path,
+		key:         loadClientKey(filepath.Join(filepath.Dir(path), CLIENT_KEY_FILE)),
+		displays:    map[string]*Display{},
+		channels:    map[string]map[chan util.Message]struct{}{},
+		connections: make(chan string, util.HUB_BUFFER_SIZE),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to read the displays %s: %v", path, err)
+	} else if err == nil {
+		var displays []*Display
+		if err = json.Unmarshal(data, &displays); err != nil {
+			log.Printf("Failed to unmarshal the displays %s: %v", path, err)
+		}
+		for _, display := range displays {
+			display.Connected = false
+			r.displays[display.ID] = display
+		}
+	}
+	return r
+}
+
+// save writes the displays to the file. The caller must hold r.mu.
+func (r *Registry) save() error {
+	displays := make([]*Display, 0, len(r.displays))
+	for _, display := range r.displays {
+		displays = append(displays, display)
+	}
+	slices.SortFunc(displays, func(a *Display, b *Display) int { return strings.Compare(a.ID, b.ID) })
+	data, err := json.MarshalIndent(displays, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the displays: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create the displays directory: %v", err)
+	}
+	if err = os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the displays %s: %v", r.path, err)
+	}
+	return nil
+}
+
+// loadClientKey returns the key signing the client cookies, creating it on the first start.
+// A key that cannot be kept only lasts until the server restarts, after which the displays get new IDs.
+func loadClientKey(path string) []byte {
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) == sha256.Size {
+		return key
+	}
+	key = make([]byte, sha256.Size)
+	rand.Read(key)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		err = os.WriteFile(path, key, 0600)
+	}
+	if err != nil {
+		log.Printf("Failed to write the client key %s: %v", path, err)
+	}
+	return key
+}
+
+// sign returns the signature of the client ID in its cookie.
+func (r *Registry) sign(id string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IssuedClientID returns the client ID of the cookie of the request, or false unless the server issued it.
+func (r *Registry) IssuedClientID(c *gin.Context) (string, bool) {
+	value, _ := c.Cookie(CLIENT_COOKIE)
+	id, signature, ok := strings.Cut(value, ".")
+	if !ok || !clientIdPattern.MatchString(id) || !hmac.Equal([]byte(signature), []byte(r.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+// ClientID returns the client ID of the display making the request from the client cookie,
+// issuing a new one to a display seen for the first time.
+// The cookie is renewed, so that a display keeps its ID across reboots.
+func (r *Registry) ClientID(c *gin.Context) string {
+	id, ok := r.IssuedClientID(c)
+	if !ok {
+		random := make([]byte, 8)
+		rand.Read(random)
+		id = hex.EncodeToString(random)
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(CLIENT_COOKIE, id+"."+r.sign(id), CLIENT_COOKIE_MAX_AGE, "/", "", false, true)
+	return id
+}
+
+// prune removes the displays disconnected for longer than DISPLAY_RETENTION without an assigned layout,
+// reporting whether any was. The caller must hold r.mu.
+func (r *Registry) prune(now time.Time) bool {
+	pruned := false
+	for id, display := range r.displays {
+		if len(r.channels[id]) == 0 && display.Layout == "" && now.Sub(display.LastSeen) > DISPLAY_RETENTION {
+			delete(r.displays, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// Connect registers a connection of the display over the push channel, updating what it reported.
+// It returns the channel of the commands sent to the display and its current state.
+// A new display is refused once the registry holds MAX_DISPLAYS, stale ones being pruned first.
+// The displays are only saved when what they reported changed, not on every connection.
+func (r *Registry) Connect(report Display) (chan util.Message, Display, error) {
+	if !clientIdPattern.MatchString(report.ID) {
+		return nil, Display{}, fmt.Errorf("invalid client ID \"%s\"", report.ID)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	display, ok := r.displays[report.ID]
+	if !ok {
+		r.prune(now)
+		if len(r.displays) >= MAX_DISPLAYS {
+			return nil, Display{}, ErrTooManyDisplays
+		}
+		display = &Display{ID: report.ID, Brightness: 1}
+		r.displays[report.ID] = display
+	}
+	changed := !ok || display.Showing != report.Showing || display.Width != report.Width || display.Height != report.Height ||
+		display.UserAgent != report.UserAgent || display.RemoteAddr != report.RemoteAddr
+	display.Showing = report.Showing
+	display.Width = report.Width
+	display.Height = report.Height
+	display.UserAgent = report.UserAgent
+	display.RemoteAddr = report.RemoteAddr
+	display.LastSeen = now
+	display.Connected = true
+
+	ch := make(chan util.Message, util.HUB_BUFFER_SIZE)
+	if r.channels[report.ID] == nil {
+		r.channels[report.ID] = map[chan util.Message]struct{}{}
+	}
+	r.channels[report.ID][ch] = struct{}{}
+	if changed {
+		if err := r.save(); err != nil {
+			log.Printf("Failed to save the displays: %v", err)
+		}
+	}
+	select {
+	case r.connections <- report.ID:
+	default:
+	}
+	return ch, *display, nil
+}
+
+// Connections returns the channel of the client IDs of the displays connecting, for a single receiver.
+func (r *Registry) Connections() <-chan string {
+	return r.connections
+}
+
+// Disconnect unregisters the connection opened by Connect and closes its channel.
+// Nothing is saved, as the displays are loaded disconnected.
+func (r *Registry) Disconnect(id string, ch chan util.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.channels[id][ch]; !ok {
+		return
+	}
+	delete(r.channels[id], ch)
+	close(ch)
+	if display, ok := r.displays[id]; ok {
+		display.LastSeen = time.Now()
+		display.Connected = len(r.channels[id]) > 0
+	}
+}
+
+// Seen records that the display is still connected.
+func (r *Registry) Seen(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if display, ok := r.displays[id]; ok {
+		display.LastSeen = time.Now()
+	}
+}
+
+// List returns the known displays by ID.
+func (r *Registry) List() []Display {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	displays := make([]Display, 0, len(r.displays))
+	for _, display := range r.displays {
+		displays = append(displays, *display)
+	}
+	slices.SortFunc(displays, func(a Display, b Display) int { return strings.Compare(a.ID, b.ID) })
+	return displays
+}
+
+// Get returns the display with the given client ID.
+func (r *Registry) Get(id string) (Display, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	display, ok := r.displays[id]
+	if !ok {
+		return Display{}, false
+	}
+	return *display, true
+}
+
+// AssignedLayout returns the layout assigned to the display, empty when none is.
+func (r *Registry) AssignedLayout(id string) string {
+	display, _ := r.Get(id)
+	return display.Layout
+}
+
+// Forget removes the display from the registry. A display still connected registers again on its next connection.
+func (r *Registry) Forget(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.displays[id]; !ok {
+		return ErrUnknownDisplay
+	}
+	delete(r.displays, id)
+	return r.save()
+}
+
+// Unassign clears the layout assigned to the display, which reloads to the layout of its schedule or URL.
+func (r *Registry) Unassign(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	display, ok := r.displays[id]
+	if !ok {
+		return ErrUnknownDisplay
+	}
+	if display.Layout == "" {
+		return nil
+	}
+	display.Layout = ""
+	if err := r.save(); err != nil {
+		return err
+	}
+	r.deliver(id, Command{Action: COMMAND_RELOAD})
+	return nil
+}
+
+// Send applies the command to the display and pushes it over its connections.
+// The assigned layout, brightness and blanking are kept for the next connections; the other commands
+// are only delivered to a connected display.
+func (r *Registry) Send(id string, command Command) error {
+	if err := command.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	display, ok := r.displays[id]
+	if !ok {
+		return ErrUnknownDisplay
+	}
+	switch command.Action {
+	case COMMAND_LAYOUT:
+		display.Layout = command.Layout
+	case COMMAND_DIM:
+		display.Brightness = *command.Brightness
+	case COMMAND_BLANK:
+		display.Blank = *command.Blank
+	default:
+		if len(r.channels[id]) == 0 {
+			return fmt.Errorf("display %s is not connected", id)
+		}
+	}
+	if command.Persistent() {
+		if err := r.save(); err != nil {
+			return err
+		}
+	}
+	r.deliver(id, command)
+	return nil
+}
+
+// Deliver pushes the command over the connections of the display without changing the state kept for it,
+// reporting whether the display is connected.
+func (r *Registry) Deliver(id string, command Command) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deliver(id, command)
+}
+
+// deliver pushes the command over the connections of the display. The caller must hold r.mu.
+func (r *Registry) deliver(id string, command Command) bool {
+	for ch := range r.channels[id] {
+		select {
+		case ch <- util.Message{Event: COMMAND_EVENT, Data: command}:
+		default:
+		}
+	}
+	return len(r.channels[id]) > 0
+}
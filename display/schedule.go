@@ -0,0 +1,210 @@
+package display
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kken7231/screensaver/jpcal"
+)
+
+// Holiday conditions of the schedule rules.
+const (
+	HOLIDAYS_ANY  = ""
+	HOLIDAYS_SKIP = "skip"
+	HOLIDAYS_ONLY = "only"
+)
+
+// SCHEDULE_ALL_DISPLAYS matches every display in the displays of a schedule.
+const SCHEDULE_ALL_DISPLAYS = "*"
+
+// SCHEDULE_RECHECK_INTERVAL is the longest the scheduler waits before checking the displays again.
+const SCHEDULE_RECHECK_INTERVAL = 10 * time.Minute
+
+// ScheduleRule represents a switch to the layout at the times of the cron expression.
+// Holidays is "skip" to ignore the Japanese national holidays, "only" to fire on them only, or empty.
+type ScheduleRule struct {
+	Cron     string `json:"cron"`
+	Layout   string `json:"layout"`
+	Holidays string `json:"holidays"`
+
+	cron Cron
+}
+
+// Schedule represents the rules of the displays listed by client ID or group name ("*" for every display).
+// The layout of the rule that fired last is shown.
+type Schedule struct {
+	Name     string         `json:"name"`
+	Displays []string       `json:"displays"`
+	Rules    []ScheduleRule `json:"rules"`
+}
+
+// ScheduleFile represents the schedules of the displays, evaluated in its time zone (local when empty).
+// A display follows the first schedule listing it.
+type ScheduleFile struct {
+	Timezone  string              `json:"timezone"`
+	Groups    map[string][]string `json:"groups"`
+	Schedules []Schedule          `json:"schedules"`
+}
+
+// ActiveLayout represents the layout a schedule shows at a time, and when it changes next.
+type ActiveLayout struct {
+	Schedule   string    `json:"schedule"`
+	Layout     string    `json:"layout"`
+	Since      time.Time `json:"since"`
+	NextChange time.Time `json:"next_change"`
+}
+
+// Scheduler resolves the layouts of the displays from their schedules
+// and switches the connected displays when a rule fires.
+type Scheduler struct {
+	registry *Registry
+	mu       sync.Mutex
+	file     ScheduleFile
+	location *time.Location
+}
+
+// NewScheduler creates a scheduler without schedules, switching the displays of the registry.
+func NewScheduler(registry *Registry) *Scheduler {
+	return &Scheduler{registry: registry, location: time.Local}
+}
+
+// LoadSchedule reads and validates the schedules of the file; a missing file means no schedules.
+// The layouts of the rules must be among layoutNames.
+func (s *Scheduler) LoadSchedule(path string, layoutNames []string) error {
+	var file ScheduleFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data = []byte("{}")
+	} else if err != nil {
+		return fmt.Errorf("failed to read the schedule %s: %v", path, err)
+	}
+	if err = json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to unmarshal the schedule %s: %v", path, err)
+	}
+
+	location := time.Local
+	if file.Timezone != "" {
+		if location, err = time.LoadLocation(file.Timezone); err != nil {
+			return fmt.Errorf("invalid time zone \"%s\" of the schedule", file.Timezone)
+		}
+	}
+	var errs []error
+	for i := range file.Schedules {
+		schedule := &file.Schedules[i]
+		for j := range schedule.Rules {
+			rule := &schedule.Rules[j]
+			if rule.cron, err = ParseCron(rule.Cron); err != nil {
+				errs = append(errs, fmt.Errorf("schedule %s: %v", schedule.Name, err))
+			}
+			if !slices.Contains(layoutNames, rule.Layout) {
+				errs = append(errs, fmt.Errorf("schedule %s: unknown layout \"%s\"", schedule.Name, rule.Layout))
+			}
+			if !slices.Contains([]string{HOLIDAYS_ANY, HOLIDAYS_SKIP, HOLIDAYS_ONLY}, rule.Holidays) {
+				errs = append(errs, fmt.Errorf("schedule %s: invalid holidays \"%s\"", schedule.Name, rule.Holidays))
+			}
+		}
+	}
+	if err = errors.Join(errs...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.file = file
+	s.location = location
+	s.mu.Unlock()
+	return nil
+}
+
+// scheduleOf returns the first schedule listing the display. The caller must hold s.mu.
+func (s *Scheduler) scheduleOf(id string) (Schedule, bool) {
+	for _, schedule := range s.file.Schedules {
+		for _, member := range schedule.Displays {
+			if member == SCHEDULE_ALL_DISPLAYS || member == id || slices.Contains(s.file.Groups[member], id) {
+				return schedule, true
+			}
+		}
+	}
+	return Schedule{}, false
+}
+
+// holidayFilter returns the day filter of the holiday condition.
+func holidayFilter(holidays string) func(time.Time) bool {
+	return func(day time.Time) bool {
+		// Holidays are defined by the date, whatever the time zone of the schedule.
+		_, isHoliday := jpcal.HolidayOf(time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, jpcal.JST))
+		switch holidays {
+		case HOLIDAYS_SKIP:
+			return !isHoliday
+		case HOLIDAYS_ONLY:
+			return isHoliday
+		}
+		return true
+	}
+}
+
+// Active returns the layout the schedule of the display shows at now, if the display has a schedule whose rules fired.
+func (s *Scheduler) Active(id string, now time.Time) (ActiveLayout, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.scheduleOf(id)
+	if !ok {
+		return ActiveLayout{}, false
+	}
+	now = now.In(s.location)
+	active := ActiveLayout{Schedule: schedule.Name}
+	for _, rule := range schedule.Rules {
+		filter := holidayFilter(rule.Holidays)
+		if last, ok := rule.cron.Last(now, filter); ok && last.After(active.Since) {
+			active.Since = last
+			active.Layout = rule.Layout
+		}
+		if next, ok := rule.cron.Next(now, filter); ok && (active.NextChange.IsZero() || next.Before(active.NextChange)) {
+			active.NextChange = next
+		}
+	}
+	return active, active.Layout != ""
+}
+
+// Start switches the connected displays to the layouts of their schedules until the context is done.
+// The displays are checked again whenever one connects, so that a switch missed while disconnected is sent again.
+// A display with a layout assigned by the admin API keeps it.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		for {
+			wait := SCHEDULE_RECHECK_INTERVAL
+			now := time.Now()
+			for _, d := range s.registry.List() {
+				if !d.Connected || d.Layout != "" {
+					continue
+				}
+				active, ok := s.Active(d.ID, now)
+				if !ok {
+					continue
+				}
+				if active.Layout != d.Showing {
+					log.Printf("Switching display %s to the layout %s of the schedule %s", d.ID, active.Layout, active.Schedule)
+					s.registry.Deliver(d.ID, Command{Action: COMMAND_LAYOUT, Layout: active.Layout})
+				}
+				if !active.NextChange.IsZero() {
+					wait = min(wait, active.NextChange.Sub(now))
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.registry.Connections():
+			case <-time.After(max(wait, time.Second)):
+			}
+		}
+	}()
+}
@@ -0,0 +1,235 @@
+// Package jpcal provides the Japanese national holidays and the rokuyō of any date.
+package jpcal
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// JST is the time zone Japanese calendar dates are defined in.
+var JST = time.FixedZone("JST", 9*60*60)
+
+// Holiday represents a national holiday.
+type Holiday struct {
+	Date   time.Time `json:"date"`
+	Name   string    `json:"name"`
+	NameEN string    `json:"name_en"`
+}
+
+// Names of the holidays given by rule rather than by date.
+const (
+	SUBSTITUTE_HOLIDAY = "振替休日"
+	CITIZENS_HOLIDAY   = "国民の休日"
+)
+
+// HOLIDAY_LAW_YEAR is the first year of the Public Holiday Law.
+const HOLIDAY_LAW_YEAR = 1949
+
+// Dates from which the substitute and citizen's holidays apply.
+var (
+	substituteHolidayStart = time.Date(1973, time.April, 12, 0, 0, 0, 0, JST)
+	citizensHolidayStart   = time.Date(1985, time.December, 27, 0, 0, 0, 0, JST)
+	substituteAnyDayStart  = time.Date(2007, time.January, 1, 0, 0, 0, 0, JST)
+)
+
+// oneOffHolidays are the holidays enacted for a single year, such as imperial ceremonies.
+var oneOffHolidays = []Holiday{
+	{time.Date(1959, time.April, 10, 0, 0, 0, 0, JST), "皇太子明仁親王の結婚の儀", "Crown Prince Akihito's Wedding"},
+	{time.Date(1989, time.February, 24, 0, 0, 0, 0, JST), "昭和天皇の大喪の礼", "Funeral of Emperor Showa"},
+	{time.Date(1990, time.November, 12, 0, 0, 0, 0, JST), "即位礼正殿の儀", "Enthronement Ceremony"},
+	{time.Date(1993, time.June, 9, 0, 0, 0, 0, JST), "皇太子徳仁親王の結婚の儀", "Crown Prince Naruhito's Wedding"},
+	{time.Date(2019, time.May, 1, 0, 0, 0, 0, JST), "天皇の即位の日", "Emperor's Accession Day"},
+	{time.Date(2019, time.October, 22, 0, 0, 0, 0, JST), "即位礼正殿の儀", "Enthronement Ceremony"},
+}
+
+// date returns the date in JST.
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, JST)
+}
+
+// nthWeekday returns the n-th given weekday of the month.
+func nthWeekday(year int, month time.Month, n int, weekday time.Weekday) time.Time {
+	first := date(year, month, 1)
+	offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+(n-1)*7)
+}
+
+// VernalEquinoxDay returns the day of March of the vernal equinox, following the approximation of the
+// National Astronomical Observatory of Japan valid from 1900 to 2150.
+func VernalEquinoxDay(year int) int {
+	base := 20.8431
+	if year < 1980 {
+		base = 20.8357
+	} else if year >= 2100 {
+		base = 21.8510
+	}
+	return int(base + 0.242194*float64(year-1980) - math.Floor(float64(year-1980)/4))
+}
+
+// AutumnalEquinoxDay returns the day of September of the autumnal equinox, following the approximation of the
+// National Astronomical Observatory of Japan valid from 1900 to 2150.
+func AutumnalEquinoxDay(year int) int {
+	base := 23.2488
+	if year < 1980 {
+		base = 23.2588
+	} else if year >= 2100 {
+		base = 24.2488
+	}
+	return int(base + 0.242194*float64(year-1980) - math.Floor(float64(year-1980)/4))
+}
+
+// fixedHolidays returns the holidays of the year defined by date or weekday, without substitute or citizen's holidays.
+func fixedHolidays(year int) []Holiday {
+	var holidays []Holiday
+	add := func(d time.Time, name, nameEN string) {
+		holidays = append(holidays, Holiday{d, name, nameEN})
+	}
+
+	add(date(year, time.January, 1), "元日", "New Year's Day")
+	if year >= 2000 {
+		add(nthWeekday(year, time.January, 2, time.Monday), "成人の日", "Coming of Age Day")
+	} else {
+		add(date(year, time.January, 15), "成人の日", "Coming of Age Day")
+	}
+	if year >= 1967 {
+		add(date(year, time.February, 11), "建国記念の日", "National Foundation Day")
+	}
+	if year >= 2020 {
+		add(date(year, time.February, 23), "天皇誕生日", "Emperor's Birthday")
+	}
+	add(date(year, time.March, VernalEquinoxDay(year)), "春分の日", "Vernal Equinox Day")
+	switch {
+	case year >= 2007:
+		add(date(year, time.April, 29), "昭和の日", "Showa Day")
+	case year >= 1989:
+		add(date(year, time.April, 29), "みどりの日", "Greenery Day")
+	default:
+		add(date(year, time.April, 29), "天皇誕生日", "Emperor's Birthday")
+	}
+	add(date(year, time.May, 3), "憲法記念日", "Constitution Memorial Day")
+	if year >= 2007 {
+		add(date(year, time.May, 4), "みどりの日", "Greenery Day")
+	}
+	add(date(year, time.May, 5), "こどもの日", "Children's Day")
+	switch {
+	case year == 2020:
+		add(date(year, time.July, 23), "海の日", "Marine Day")
+	case year == 2021:
+		add(date(year, time.July, 22), "海の日", "Marine Day")
+	case year >= 2003:
+		add(nthWeekday(year, time.July, 3, time.Monday), "海の日", "Marine Day")
+	case year >= 1996:
+		add(date(year, time.July, 20), "海の日", "Marine Day")
+	}
+	switch {
+	case year == 2020:
+		add(date(year, time.August, 10), "山の日", "Mountain Day")
+	case year == 2021:
+		add(date(year, time.August, 8), "山の日", "Mountain Day")
+	case year >= 2016:
+		add(date(year, time.August, 11), "山の日", "Mountain Day")
+	}
+	if year >= 2003 {
+		add(nthWeekday(year, time.September, 3, time.Monday), "敬老の日", "Respect for the Aged Day")
+	} else if year >= 1966 {
+		add(date(year, time.September, 15), "敬老の日", "Respect for the Aged Day")
+	}
+	add(date(year, time.September, AutumnalEquinoxDay(year)), "秋分の日", "Autumnal Equinox Day")
+	switch {
+	case year == 2020:
+		add(date(year, time.July, 24), "スポーツの日", "Sports Day")
+	case year == 2021:
+		add(date(year, time.July, 23), "スポーツの日", "Sports Day")
+	case year >= 2020:
+		add(nthWeekday(year, time.October, 2, time.Monday), "スポーツの日", "Sports Day")
+	case year >= 2000:
+		add(nthWeekday(year, time.October, 2, time.Monday), "体育の日", "Health and Sports Day")
+	case year >= 1966:
+		add(date(year, time.October, 10), "体育の日", "Health and Sports Day")
+	}
+	add(date(year, time.November, 3), "文化の日", "Culture Day")
+	add(date(year, time.November, 23), "勤労感謝の日", "Labour Thanksgiving Day")
+	if year >= 1989 && year <= 2018 {
+		add(date(year, time.December, 23), "天皇誕生日", "Emperor's Birthday")
+	}
+
+	for _, holiday := range oneOffHolidays {
+		if holiday.Date.Year() == year {
+			holidays = append(holidays, holiday)
+		}
+	}
+	return holidays
+}
+
+// Holidays returns the national holidays of the year in date order,
+// including the substitute holidays and citizen's holidays.
+func Holidays(year int) []Holiday {
+	if year < HOLIDAY_LAW_YEAR {
+		return []Holiday{}
+	}
+
+	holidays := fixedHolidays(year)
+	isHoliday := func(d time.Time) bool {
+		return slices.ContainsFunc(holidays, func(h Holiday) bool { return h.Date.Equal(d) })
+	}
+
+	// A holiday on a Sunday moves to the next day that is not a holiday (only the Monday before 2007).
+	var substitutes []Holiday
+	for _, holiday := range holidays {
+		if holiday.Date.Weekday() != time.Sunday || holiday.Date.Before(substituteHolidayStart) {
+			continue
+		}
+		substitute := holiday.Date.AddDate(0, 0, 1)
+		if !substitute.Before(substituteAnyDayStart) {
+			for isHoliday(substitute) {
+				substitute = substitute.AddDate(0, 0, 1)
+			}
+		} else if isHoliday(substitute) {
+			continue
+		}
+		substitutes = append(substitutes, Holiday{substitute, SUBSTITUTE_HOLIDAY, "Substitute Holiday"})
+	}
+	holidays = append(holidays, substitutes...)
+
+	// A day between two holidays becomes a holiday too (unless it is a Sunday).
+	slices.SortFunc(holidays, func(a Holiday, b Holiday) int { return a.Date.Compare(b.Date) })
+	var citizens []Holiday
+	for i := 0; i+1 < len(holidays); i++ {
+		between := holidays[i].Date.AddDate(0, 0, 1)
+		if holidays[i+1].Date.Equal(between.AddDate(0, 0, 1)) && !isHoliday(between) &&
+			between.Weekday() != time.Sunday && !between.Before(citizensHolidayStart) {
+			citizens = append(citizens, Holiday{between, CITIZENS_HOLIDAY, "Citizen's Holiday"})
+		}
+	}
+	holidays = append(holidays, citizens...)
+
+	slices.SortFunc(holidays, func(a Holiday, b Holiday) int { return a.Date.Compare(b.Date) })
+	return holidays
+}
+
+// holidayCache holds the computed holidays by year.
+var (
+	holidayCache      = map[int][]Holiday{}
+	holidayCacheMutex sync.Mutex
+)
+
+// HolidayOf returns the national holiday falling on the date of t in JST, if any.
+func HolidayOf(t time.Time) (Holiday, bool) {
+	t = t.In(JST)
+	day := date(t.Year(), t.Month(), t.Day())
+	holidayCacheMutex.Lock()
+	holidays, ok := holidayCache[t.Year()]
+	if !ok {
+		holidays = Holidays(t.Year())
+		holidayCache[t.Year()] = holidays
+	}
+	holidayCacheMutex.Unlock()
+	for _, holiday := range holidays {
+		if holiday.Date.Equal(day) {
+			return holiday, true
+		}
+	}
+	return Holiday{}, false
+}
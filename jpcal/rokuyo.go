@@ -0,0 +1,183 @@
+package jpcal
+
+import (
+	"math"
+	"time"
+)
+
+// Rokuyō, the six-day cycle of lucky and unlucky days, in the order of (lunar month + lunar day) mod 6.
+var rokuyoNames = []Rokuyo{
+	{"大安", "Taian"},
+	{"赤口", "Shakko"},
+	{"先勝", "Sensho"},
+	{"友引", "Tomobiki"},
+	{"先負", "Senbu"},
+	{"仏滅", "Butsumetsu"},
+}
+
+// Rokuyo represents one of the six days of the rokuyō cycle.
+type Rokuyo struct {
+	Name   string `json:"name"`
+	NameEN string `json:"name_en"`
+}
+
+// LunarDate represents a date of the Japanese lunisolar calendar (the Tenpō calendar rules).
+type LunarDate struct {
+	Month int  `json:"month"`
+	Day   int  `json:"day"`
+	Leap  bool `json:"leap"`
+}
+
+// SYNODIC_MONTH is the mean length of a lunation in days.
+const SYNODIC_MONTH = 29.530588861
+
+// Constants of the ephemeris.
+const (
+	rad        = math.Pi / 180
+	julian1970 = 2440587.5
+	julian2000 = 2451545.0
+)
+
+// toJulian returns the Julian day of t.
+func toJulian(t time.Time) float64 {
+	return float64(t.UnixMilli())/float64(24*time.Hour/time.Millisecond) + julian1970
+}
+
+// fromJulian returns the time of the Julian day jd.
+func fromJulian(jd float64) time.Time {
+	return time.UnixMilli(int64(math.Round((jd - julian1970) * float64(24*time.Hour/time.Millisecond))))
+}
+
+// deltaT returns the approximate difference between terrestrial and universal time in days.
+func deltaT(jd float64) float64 {
+	y := (jd - julian2000) / 365.25
+	return (62.92 + 0.32217*y + 0.005589*y*y) / 86400
+}
+
+// newMoon returns the Julian day (UT) of the k-th new moon after the one of January 6, 2000,
+// using the algorithm of Meeus (Astronomical Algorithms, ch. 49), accurate to about a minute.
+func newMoon(k float64) float64 {
+	t := k / 1236.85
+	jde := 2451550.09766 + SYNODIC_MONTH*k + 0.00015437*t*t - 0.000000150*t*t*t + 0.00000000073*t*t*t*t
+	e := 1 - 0.002516*t - 0.0000074*t*t
+	m := rad * (2.5534 + 29.10535670*k - 0.0000014*t*t - 0.00000011*t*t*t)
+	mm := rad * (201.5643 + 385.81693528*k + 0.0107582*t*t + 0.00001238*t*t*t - 0.000000058*t*t*t*t)
+	f := rad * (160.7108 + 390.67050284*k - 0.0016118*t*t - 0.00000227*t*t*t + 0.000000011*t*t*t*t)
+	omega := rad * (124.7746 - 1.56375588*k + 0.0020672*t*t + 0.00000215*t*t*t)
+
+	jde += -0.40720*math.Sin(mm) +
+		0.17241*e*math.Sin(m) +
+		0.01608*math.Sin(2*mm) +
+		0.01039*math.Sin(2*f) +
+		0.00739*e*math.Sin(mm-m) -
+		0.00514*e*math.Sin(mm+m) +
+		0.00208*e*e*math.Sin(2*m) -
+		0.00111*math.Sin(mm-2*f) -
+		0.00057*math.Sin(mm+2*f) +
+		0.00056*e*math.Sin(2*mm+m) -
+		0.00042*math.Sin(3*mm) +
+		0.00042*e*math.Sin(m+2*f) +
+		0.00038*e*math.Sin(m-2*f) -
+		0.00024*e*math.Sin(2*mm-m) -
+		0.00017*math.Sin(omega) -
+		0.00007*math.Sin(mm+2*m) +
+		0.00004*math.Sin(2*mm-2*f) +
+		0.00004*math.Sin(3*m) +
+		0.00003*math.Sin(mm+m-2*f) +
+		0.00003*math.Sin(2*mm+2*f) -
+		0.00003*math.Sin(mm+m+2*f) +
+		0.00003*math.Sin(mm-m+2*f) -
+		0.00002*math.Sin(mm-m-2*f) -
+		0.00002*math.Sin(3*mm+m) +
+		0.00002*math.Sin(4*mm)
+
+	// Planetary arguments.
+	planetary := [][3]float64{
+		{299.77, 0.107408, 0.000325}, {251.88, 0.016321, 0.000165}, {251.83, 26.651886, 0.000164},
+		{349.42, 36.412478, 0.000126}, {84.66, 18.206239, 0.000110}, {141.74, 53.303771, 0.000062},
+		{207.14, 2.453732, 0.000060}, {154.84, 7.306860, 0.000056}, {34.52, 27.261239, 0.000047},
+		{207.19, 0.121824, 0.000042}, {291.34, 1.844379, 0.000040}, {161.72, 24.198154, 0.000037},
+		{239.56, 25.513099, 0.000035}, {331.55, 3.592518, 0.000023},
+	}
+	for i, p := range planetary {
+		argument := p[0] + p[1]*k
+		if i == 0 {
+			argument -= 0.009173 * t * t
+		}
+		jde += p[2] * math.Sin(rad*argument)
+	}
+	return jde - deltaT(jde)
+}
+
+// sunLongitude returns the apparent ecliptic longitude of the sun in degrees at the Julian day jd,
+// accurate to about 0.01° (Meeus, ch. 25).
+func sunLongitude(jd float64) float64 {
+	t := (jd + deltaT(jd) - julian2000) / 36525
+	l0 := 280.46646 + 36000.76983*t + 0.0003032*t*t
+	m := rad * (357.52911 + 35999.05029*t - 0.0001537*t*t)
+	center := (1.914602-0.004817*t-0.000014*t*t)*math.Sin(m) + (0.019993-0.000101*t)*math.Sin(2*m) + 0.000289*math.Sin(3*m)
+	omega := rad * (125.04 - 1934.136*t)
+	longitude := l0 + center - 0.00569 - 0.00478*math.Sin(omega)
+	return math.Mod(math.Mod(longitude, 360)+360, 360)
+}
+
+// startOfDay returns the start of the JST day of t.
+func startOfDay(t time.Time) time.Time {
+	t = t.In(JST)
+	return date(t.Year(), t.Month(), t.Day())
+}
+
+// lunarMonthStart returns the first day of the k-th lunar month, the JST day of its new moon.
+func lunarMonthStart(k float64) time.Time {
+	return startOfDay(fromJulian(newMoon(k)))
+}
+
+// principalTermMonth returns the month number given by the principal term (chūki) falling in the lunar month
+// from start until end, or 0 when there is none and the month is a leap month.
+func principalTermMonth(start, end time.Time) int {
+	from := sunLongitude(toJulian(start))
+	to := sunLongitude(toJulian(end))
+	termFrom := int(math.Floor(from / 30))
+	termTo := int(math.Floor(to / 30))
+	if termFrom == termTo {
+		return 0
+	}
+	// The term at 330° (雨水) starts the first month and the winter solstice at 270° falls in the eleventh.
+	return (termTo+1)%12 + 1
+}
+
+// LunarDateOf returns the date of the Japanese lunisolar calendar of t.
+// Leap months are the lunar months without a principal term, which take the number of the previous month.
+// The rule is applied as is, so the months around the "2033 problem" differ from the published almanacs.
+func LunarDateOf(t time.Time) LunarDate {
+	day := startOfDay(t)
+
+	// Find the new moon starting the lunar month of the day.
+	k := math.Floor((toJulian(day) - 2451550.09766) / SYNODIC_MONTH)
+	for lunarMonthStart(k).After(day) {
+		k--
+	}
+	for !lunarMonthStart(k + 1).After(day) {
+		k++
+	}
+	start := lunarMonthStart(k)
+
+	month := principalTermMonth(start, lunarMonthStart(k+1))
+	leap := false
+	for i := k - 1; month == 0; i-- {
+		leap = true
+		month = principalTermMonth(lunarMonthStart(i), lunarMonthStart(i+1))
+	}
+
+	return LunarDate{
+		Month: month,
+		Day:   int(math.Round(day.Sub(start).Hours()/24)) + 1,
+		Leap:  leap,
+	}
+}
+
+// RokuyoOf returns the rokuyō of the date of t in JST.
+func RokuyoOf(t time.Time) Rokuyo {
+	lunar := LunarDateOf(t)
+	return rokuyoNames[(lunar.Month+lunar.Day)%6]
+}
@@ -0,0 +1,68 @@
+package jpcal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kken7231/screensaver/notion"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HolidaySource is the calendar source of the national holidays, given as all-day events.
+type HolidaySource struct{}
+
+// Events returns the national holiday of the day, if any, as an all-day event.
+func (HolidaySource) Events(ctx context.Context, day time.Time) ([]notion.RawEvent, error) {
+	holiday, ok := HolidayOf(day)
+	if !ok {
+		return []notion.RawEvent{}, nil
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return []notion.RawEvent{{
+		Name:      holiday.Name,
+		Start:     start,
+		End:       start.AddDate(0, 0, 1).Add(time.Nanosecond * -1),
+		IsAllDay:  true,
+		IsHoliday: true,
+	}}, nil
+}
+
+// DayData represents the calendar annotations of a day for display.
+type DayData struct {
+	Holiday   string `json:"holiday"`
+	IsHoliday bool   `json:"is_holiday"`
+	Rokuyo    string `json:"rokuyo"`
+	LunarDate string `json:"lunar_date"`
+}
+
+// ParseDayData returns the holiday, rokuyō and lunar date of the day of t.
+func ParseDayData(t time.Time) DayData {
+	holiday, ok := HolidayOf(t)
+	lunar := LunarDateOf(t)
+	leap := ""
+	if lunar.Leap {
+		leap = "閏"
+	}
+	return DayData{
+		Holiday:   holiday.Name,
+		IsHoliday: ok,
+		Rokuyo:    RokuyoOf(t).Name,
+		LunarDate: fmt.Sprintf("旧%s%d月%d日", leap, lunar.Month, lunar.Day),
+	}
+}
+
+// DayCheckQuery checks and validates query parameters for calendar day requests.
+// The date is taken in JST and defaults to today.
+func DayCheckQuery(c *gin.Context) (time.Time, error) {
+	date_str := c.Query("date")
+	if date_str == "" {
+		return time.Now().In(JST), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", date_str, JST)
+	if err != nil {
+		return day, fmt.Errorf("please provide a date in the YYYY-MM-DD format")
+	}
+	return day, nil
+}
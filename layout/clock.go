@@ -0,0 +1,103 @@
+package layout
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Clock formats and languages.
+const (
+	CLOCK_FORMAT_24H  = "24h"
+	CLOCK_FORMAT_12H  = "12h"
+	CLOCK_LANGUAGE_EN = "EN"
+	CLOCK_LANGUAGE_JP = "JP"
+)
+
+// ClockCity represents a city of a world-clock board.
+// The coordinates are optional; without them, the night is assumed from 18:00 to 6:00 local time.
+type ClockCity struct {
+	Name      string   `json:"name"`
+	Timezone  string   `json:"timezone"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+// ClockOptions represents the rendering options of a clock widget.
+// An empty time zone means the time zone of the browser.
+type ClockOptions struct {
+	Hour12   bool        `json:"hour12"`
+	Seconds  bool        `json:"seconds"`
+	Language string      `json:"language"`
+	Timezone string      `json:"timezone"`
+	Cities   []ClockCity `json:"cities"`
+}
+
+// ParseClockOptions reads the clock options from the widget data:
+// "clock_format" ("24h" or "12h"), "clock_seconds", "clock_language" ("EN" or "JP"), "location_timezone"
+// and, for the world-clock boards, "locations" as a list of {"name", "timezone", "latitude", "longitude"} objects.
+func (w Widget) ParseClockOptions() (ClockOptions, error) {
+	options := ClockOptions{
+		Seconds:  true,
+		Language: CLOCK_LANGUAGE_EN,
+		Cities:   []ClockCity{},
+	}
+
+	if format, ok := w.Data["clock_format"]; ok {
+		format_str, ok := format.(string)
+		if !ok || !slices.Contains([]string{CLOCK_FORMAT_24H, CLOCK_FORMAT_12H}, format_str) {
+			return options, fmt.Errorf("invalid clock format %v", format)
+		}
+		options.Hour12 = format_str == CLOCK_FORMAT_12H
+	}
+	if seconds, ok := w.Data["clock_seconds"]; ok {
+		if options.Seconds, ok = seconds.(bool); !ok {
+			return options, fmt.Errorf("invalid clock seconds %v", seconds)
+		}
+	}
+	if language, ok := w.Data["clock_language"]; ok {
+		language_str, ok := language.(string)
+		if !ok || !slices.Contains([]string{CLOCK_LANGUAGE_EN, CLOCK_LANGUAGE_JP}, language_str) {
+			return options, fmt.Errorf("invalid clock language %v", language)
+		}
+		options.Language = language_str
+	}
+	if timezone, ok := w.Data["location_timezone"]; ok {
+		timezone_str, ok := timezone.(string)
+		if !ok {
+			return options, fmt.Errorf("invalid time zone %v", timezone)
+		}
+		if _, err := time.LoadLocation(timezone_str); err != nil {
+			return options, fmt.Errorf("invalid time zone \"%s\"", timezone_str)
+		}
+		options.Timezone = timezone_str
+	}
+
+	locations, _ := w.Data["locations"].([]interface{})
+	for _, location := range locations {
+		locationData, ok := location.(map[string]interface{})
+		if !ok {
+			return options, fmt.Errorf("invalid clock location %v", location)
+		}
+		var city ClockCity
+		city.Name, _ = locationData["name"].(string)
+		city.Timezone, _ = locationData["timezone"].(string)
+		if city.Name == "" || city.Timezone == "" {
+			return options, fmt.Errorf("clock location %v needs a name and a time zone", location)
+		}
+		if _, err := time.LoadLocation(city.Timezone); err != nil {
+			return options, fmt.Errorf("invalid time zone \"%s\"", city.Timezone)
+		}
+		latitude, okLatitude := locationData["latitude"].(float64)
+		longitude, okLongitude := locationData["longitude"].(float64)
+		if okLatitude && okLongitude {
+			city.Latitude = &latitude
+			city.Longitude = &longitude
+		}
+		options.Cities = append(options.Cities, city)
+	}
+	if variant := w.Variant(); (variant == LongH || variant == Large) && len(options.Cities) == 0 {
+		return options, fmt.Errorf("world clocks need at least one location")
+	}
+	return options, nil
+}
@@ -4,19 +4,140 @@ package layout
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
+
+	"github.com/kken7231/screensaver/config"
+)
+
+// settings holds the configuration of the application, as given to Configure.
+var settings = config.Default()
+
+// layoutFS holds the layout files, as given to Configure.
+var layoutFS fs.FS = os.DirFS(settings.Paths.Layouts)
+
+// Configure sets the configuration and the layout files used to load and render layouts.
+func Configure(cfg config.Config, layouts fs.FS) {
+	settings = cfg
+	layoutFS = layouts
+}
+
+// DEFAULT_PAGE_DWELL is how many seconds a page of a carousel is shown when neither the page nor the layout sets it.
+const DEFAULT_PAGE_DWELL = 30
+
+// Transitions between the pages of a carousel.
+const (
+	TRANSITION_SLIDE = "slide"
+	TRANSITION_FADE  = "fade"
 )
 
 // Layout represents the structure of a layout with its name, dimensions, and widgets.
+// A layout listing pages is a carousel rotating them, and its own dimensions and widgets are ignored.
+// Portrait is the grid the widgets are placed again in on a portrait screen.
 type Layout struct {
-	Name    string   `json:"name"`
-	Rows    int      `json:"rows"`
-	Cols    int      `json:"cols"`
-	Widgets []Widget `json:"widgets"`
+	Name       string   `json:"name"`
+	Rows       int      `json:"rows"`
+	Cols       int      `json:"cols"`
+	Portrait   *Grid    `json:"portrait"`
+	Widgets    []Widget `json:"widgets"`
+	Pages      []Page   `json:"pages"`
+	Dwell      int      `json:"dwell"`
+	Transition string   `json:"transition"`
+}
+
+// Page represents a page of a carousel with its own dimensions and widgets, shown for Dwell seconds.
+type Page struct {
+	Name     string   `json:"name"`
+	Rows     int      `json:"rows"`
+	Cols     int      `json:"cols"`
+	Portrait *Grid    `json:"portrait"`
+	Dwell    int      `json:"dwell"`
+	Widgets  []Widget `json:"widgets"`
+}
+
+// pages returns the pages as written in the layout, a single one for a layout without pages.
+func (l Layout) pages() []Page {
+	if len(l.Pages) == 0 {
+		return []Page{{Name: l.Name, Rows: l.Rows, Cols: l.Cols, Portrait: l.Portrait, Widgets: l.Widgets}}
+	}
+	return slices.Clone(l.Pages)
+}
+
+// GetPages returns the pages of the layout, a single one for a layout without pages.
+// The widgets without a position are placed, the widgets are numbered with their page,
+// and the dwell times default to the one of the layout.
+func (l Layout) GetPages() []Page {
+	pages := l.pages()
+	result := make([]Page, len(pages))
+	for i, page := range pages {
+		if page.Dwell <= 0 {
+			page.Dwell = l.Dwell
+		}
+		if page.Dwell <= 0 {
+			page.Dwell = DEFAULT_PAGE_DWELL
+		}
+		page.Widgets = PlaceWidgets(page.Widgets, page.Rows, page.Cols)
+		for j := range page.Widgets {
+			page.Widgets[j].Page = i
+		}
+		result[i] = page
+	}
+	return result
+}
+
+// CheckGrid returns the widgets of the page lying outside its grid, overlapping another widget
+// or left without a position by PlaceWidgets.
+func (p Page) CheckGrid() error {
+	var errs []error
+	if err := checkGrid(p.Rows, p.Cols); err != nil {
+		return fmt.Errorf("page %s: %v", p.Name, err)
+	}
+	occupied := map[[2]int64]string{}
+	for _, widget := range p.Widgets {
+		rows, cols := widget.Spans()
+		if !widget.hasPosition() {
+			errs = append(errs, fmt.Errorf("%s Widget of %dx%d does not fit in the free cells of the %dx%d grid",
+				widget.Type, rows, cols, p.Rows, p.Cols))
+			continue
+		}
+		lastRow, lastCol := widget.Row+int64(rows)-1, widget.Col+int64(cols)-1
+		if widget.Row < 1 || widget.Col < 1 || lastRow > int64(p.Rows) || lastCol > int64(p.Cols) {
+			errs = append(errs, fmt.Errorf("%s spans rows %d-%d and columns %d-%d, outside the %dx%d grid",
+				widget.GetId(), widget.Row, lastRow, widget.Col, lastCol, p.Rows, p.Cols))
+			continue
+		}
+		overlapped := map[string]bool{}
+		for row := widget.Row; row <= lastRow; row++ {
+			for col := widget.Col; col <= lastCol; col++ {
+				if other, ok := occupied[[2]int64{row, col}]; ok && !overlapped[other] {
+					overlapped[other] = true
+					errs = append(errs, fmt.Errorf("%s overlaps %s at row %d, column %d", widget.GetId(), other, row, col))
+				}
+				occupied[[2]int64{row, col}] = widget.GetId()
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AllWidgets returns the widgets of every page of the layout, followed in a stack by the widgets of the stack.
+func (l Layout) AllWidgets() []Widget {
+	var widgets []Widget
+	for _, page := range l.GetPages() {
+		for _, widget := range page.Widgets {
+			children, _ := widget.Children()
+			widgets = append(widgets, widget)
+			widgets = append(widgets, children...)
+		}
+	}
+	return widgets
 }
 
 // // RegisterLayoutRoutes registers the routes for saving and loading layouts.
@@ -62,7 +183,10 @@ type Layout struct {
 // loadLayout loads the layout with the given name from a JSON file.
 func loadLayout(name string) (Layout, error) {
 	var layout Layout
-	data, err := os.ReadFile("layouts/" + name + ".json")
+	if !fs.ValidPath(name) || strings.Contains(name, "/") {
+		return layout, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := fs.ReadFile(layoutFS, name+".json")
 	if err != nil {
 		return layout, err
 	}
@@ -70,69 +194,174 @@ func loadLayout(name string) (Layout, error) {
 	return layout, err
 }
 
-// GetLayout retrieves and processes the layout with the given name,
+// LayoutNames returns the names of the available layouts, embedded or stored in the layouts directory.
+func LayoutNames() ([]string, error) {
+	paths, err := fs.Glob(layoutFS, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		names = append(names, strings.TrimSuffix(path, ".json"))
+	}
+	return names, nil
+}
+
+// ListLayouts loads every layout, embedded or stored in the layouts directory.
+func ListLayouts() ([]Layout, error) {
+	var layouts []Layout
+	paths, err := fs.Glob(layoutFS, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		layout, err := loadLayout(strings.TrimSuffix(path, ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load layout %s: %v", path, err)
+		}
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// render resolves the locations of the widget, then renders and checks it.
+func (w *Widget) render() (string, error) {
+	if err := w.ResolveLocations(); err != nil {
+		log.Printf("Unable to resolve the location of %s: %v", w.GetId(), err)
+	}
+	content, err := w.RenderContent()
+	if ok := w.DataCheck(); err == nil && !ok {
+		err = fmt.Errorf("invalid data for %s Widget %s", w.Type, w.GetId())
+	}
+	return content, err
+}
+
+// ValidateLayout loads the layout with the given name and renders every widget,
+// returning the errors the displays would show.
+func ValidateLayout(name string) error {
+	layout, err := loadLayout(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if !slices.Contains([]string{"", TRANSITION_SLIDE, TRANSITION_FADE}, layout.Transition) {
+		errs = append(errs, fmt.Errorf("invalid transition \"%s\"", layout.Transition))
+	}
+	// The widgets cannot be placed in a grid without rows or columns.
+	if err := layout.checkGrids(); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, orientation := range []string{ORIENTATION_LANDSCAPE, ORIENTATION_PORTRAIT} {
+		if orientation == ORIENTATION_PORTRAIT && !layout.HasPortrait() {
+			continue
+		}
+		for _, page := range layout.InOrientation(orientation).GetPages() {
+			if err := page.CheckGrid(); err != nil {
+				errs = append(errs, fmt.Errorf("in %s: %w", orientation, err))
+			}
+		}
+	}
+	for _, widget := range layout.AllWidgets() {
+		// The widgets of a stack are validated on their own, so only the data of the stack is checked.
+		if widget.Type == StackWidget {
+			if _, err := widget.Children(); err != nil {
+				errs = append(errs, err)
+			} else if !widget.DataCheck() {
+				errs = append(errs, fmt.Errorf("invalid data for %s Widget %s", widget.Type, widget.GetId()))
+			}
+			continue
+		}
+		if _, err := widget.render(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetLayout retrieves and processes the layout with the given name for a screen of the orientation,
 // returning a map of its properties for rendering.
-func GetLayout(layoutName string) map[string]interface{} {
-	var renderedWidgets []map[string]interface{}
+// A widget failing to render is replaced by an error card, so that only a missing or broken layout file is an error.
+func GetLayout(layoutName string, orientation string) (map[string]interface{}, error) {
+	var renderedPages []map[string]interface{}
+	var themeLocation map[string]float64
 
 	if layoutName == "" {
 		layoutName = "default"
 	}
 	layout, err := loadLayout(layoutName)
 	if err != nil {
-		log.Fatalf("Unable to load layout %s", layoutName)
-		return map[string]interface{}{
-			"nrow":    0,
-			"ncol":    0,
-			"gap":     "16px",
-			"margin":  "16px",
-			"widgets": renderedWidgets,
-		}
+		return nil, fmt.Errorf("unable to load layout %s: %w", layoutName, err)
+	}
+	if orientation != ORIENTATION_PORTRAIT {
+		orientation = ORIENTATION_LANDSCAPE
 	}
-	for _, widget := range layout.Widgets {
-		if ok := widget.DataCheck(); !ok {
-			log.Fatalf("Data Check failed %s", layoutName)
-		}
-		lrow := 1
-		lcol := 1
-		// Set widget dimensions based on its size
-		switch widget.Size {
-		case MiddleV:
-			lrow = 2
-		case MiddleH:
-			lcol = 2
-		case Large:
-			lrow = 2
-			lcol = 2
-		case LongH:
-			lcol = 4
-		case LongV:
-			lrow = 4
-		}
-		// Append widget properties to the rendered widgets slice
-		renderedWidgets = append(renderedWidgets, map[string]interface{}{
-			"irow":          widget.Row,
-			"lrow":          lrow,
-			"icol":          widget.Col,
-			"lcol":          lcol,
-			"padding":       template.CSS("calc(var(--cell-size) * 0.1)"),
-			"showUpdateBtn": ShowUpdateBtn(widget.Type),
-			"wgcontent":     template.HTML(widget.RenderContent()),
-			"widgetId":      widget.GetId(),
-			"wgquery":       fmt.Sprintf("size=%s&%s", widget.Size, mapToQueryString(widget.Data)),
-			"wgtype":        widget.Type,
+	for _, page := range layout.InOrientation(orientation).GetPages() {
+		var renderedWidgets []map[string]interface{}
+		if err := page.CheckGrid(); err != nil {
+			log.Printf("Layout %s: %v", layoutName, strings.ReplaceAll(err.Error(), "\n", "; "))
+		}
+		for _, widget := range page.Widgets {
+			// Widgets that do not fit are reported by CheckGrid.
+			if !widget.hasPosition() {
+				continue
+			}
+			content, err := widget.render()
+			if err != nil {
+				log.Printf("Unable to render %s of layout %s: %v", widget.GetId(), layoutName, err)
+				content = RenderError(widget.GetId(), err.Error())
+			}
+			// The first located widget, or widget of a stack, decides when the theme turns dark.
+			children, _ := widget.Children()
+			for _, located := range append([]Widget{widget}, children...) {
+				latitude, okLatitude := located.Data["location_latitude"].(float64)
+				longitude, okLongitude := located.Data["location_longitude"].(float64)
+				if themeLocation == nil && okLatitude && okLongitude {
+					themeLocation = map[string]float64{"latitude": latitude, "longitude": longitude}
+				}
+			}
+			lrow, lcol := widget.Spans()
+			// Append widget properties to the rendered widgets slice
+			renderedWidgets = append(renderedWidgets, map[string]interface{}{
+				"irow":            widget.Row,
+				"lrow":            lrow,
+				"icol":            widget.Col,
+				"lcol":            lcol,
+				"padding":         template.CSS("calc(var(--cell-size) * 0.1)"),
+				"showUpdateBtn":   err == nil && ShowUpdateBtn(widget.Type),
+				"refreshInterval": RefreshInterval(widget.Type),
+				"wgcontent":       template.HTML(content),
+				"widgetId":        widget.GetId(),
+				"wgquery":         fmt.Sprintf("size=%s&%s", widget.Variant(), mapToQueryString(widget.Data)),
+				"wgtype":          widget.Type,
+			})
+		}
+		renderedPages = append(renderedPages, map[string]interface{}{
+			"name":    page.Name,
+			"nrow":    page.Rows,
+			"ncol":    page.Cols,
+			"dwell":   page.Dwell,
+			"widgets": renderedWidgets,
 		})
 	}
-	return map[string]interface{}{
-		"nrow":    layout.Rows,
-		"ncol":    layout.Cols,
-		"gap":     "16px",
-		"margin":  "16px",
-		"widgets": renderedWidgets,
+	transition := layout.Transition
+	if transition != TRANSITION_FADE {
+		transition = TRANSITION_SLIDE
 	}
+	return map[string]interface{}{
+		"layoutName":     layoutName,
+		"orientation":    orientation,
+		"hasPortrait":    layout.HasPortrait(),
+		"pages":          renderedPages,
+		"transition":     transition,
+		"gap":            settings.Display.Gap,
+		"margin":         settings.Display.Margin,
+		"themeLocation":  themeLocation,
+		"themeSeedColor": settings.Display.ThemeSeedColor,
+	}, nil
 }
 
 // mapToQueryString converts a map to a query string format.
+// Lists and objects are encoded as JSON.
 func mapToQueryString(m map[string]interface{}) string {
 	var sb strings.Builder
 	first := true
@@ -140,9 +369,16 @@ func mapToQueryString(m map[string]interface{}) string {
 		if !first {
 			sb.WriteString("&")
 		}
-		sb.WriteString(key)
+		valueStr := fmt.Sprintf("%v", value)
+		switch value.(type) {
+		case []interface{}, map[string]interface{}:
+			if encoded, err := json.Marshal(value); err == nil {
+				valueStr = string(encoded)
+			}
+		}
+		sb.WriteString(url.QueryEscape(key))
 		sb.WriteString("=")
-		sb.WriteString(fmt.Sprintf("%v", value))
+		sb.WriteString(url.QueryEscape(valueStr))
 		first = false
 	}
 	return sb.String()
@@ -0,0 +1,276 @@
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kken7231/screensaver/util"
+)
+
+// LOCATION_CACHE_FILE is the file in the layout store caching resolved locations.
+const LOCATION_CACHE_FILE = ".cache/locations.json"
+
+// locationCachePath returns the path of the location cache in the configured layout store.
+func locationCachePath() string {
+	return filepath.Join(settings.Paths.Layouts, LOCATION_CACHE_FILE)
+}
+
+// ResolvedLocation represents the coordinates and time zone resolved from a place name or postal code.
+type ResolvedLocation struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+}
+
+// LocationResolver resolves a location query such as "Fukuoka" or "810-0001" into coordinates.
+// It is provided by the application, as resolving requires the weather package.
+var LocationResolver func(query string) (ResolvedLocation, error)
+
+// locationCache holds the resolved locations keyed by normalized query.
+var locationCache struct {
+	mu        sync.Mutex
+	loaded    bool
+	locations map[string]ResolvedLocation
+}
+
+// normalizeLocationQuery normalizes a location query for use as a cache key.
+func normalizeLocationQuery(query string) string {
+	return strings.ToLower(strings.TrimSpace(query))
+}
+
+// loadLocationCache loads the location cache from the layout store. The caller must hold locationCache.mu.
+func loadLocationCache() error {
+	if locationCache.loaded {
+		return nil
+	}
+	locationCache.locations = map[string]ResolvedLocation{}
+	data, err := os.ReadFile(locationCachePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		locationCache.loaded = true
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read location cache: %v", err)
+	}
+	if err = json.Unmarshal(data, &locationCache.locations); err != nil {
+		return fmt.Errorf("failed to unmarshal location cache: %v", err)
+	}
+	locationCache.loaded = true
+	return nil
+}
+
+// CachedLocation returns the cached resolution of the location query.
+func CachedLocation(query string) (ResolvedLocation, bool) {
+	locationCache.mu.Lock()
+	defer locationCache.mu.Unlock()
+
+	if err := loadLocationCache(); err != nil {
+		return ResolvedLocation{}, false
+	}
+	location, ok := locationCache.locations[normalizeLocationQuery(query)]
+	return location, ok
+}
+
+// CacheLocation stores the resolution of the location query in the layout store.
+func CacheLocation(query string, location ResolvedLocation) error {
+	locationCache.mu.Lock()
+	defer locationCache.mu.Unlock()
+
+	if err := loadLocationCache(); err != nil {
+		return err
+	}
+	locationCache.locations[normalizeLocationQuery(query)] = location
+
+	data, err := json.MarshalIndent(locationCache.locations, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal location cache: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(locationCachePath()), 0755); err != nil {
+		return fmt.Errorf("failed to create location cache directory: %v", err)
+	}
+	return os.WriteFile(locationCachePath(), data, 0644)
+}
+
+// pendingLocations holds the normalized location queries being resolved in the background.
+var pendingLocations struct {
+	mu      sync.Mutex
+	queries map[string]struct{}
+}
+
+// ResolveLocationQuery resolves the location query and caches the result, unless it is cached already.
+// It reports whether the query was newly resolved.
+func ResolveLocationQuery(query string) (bool, error) {
+	if _, ok := CachedLocation(query); ok {
+		return false, nil
+	}
+	if LocationResolver == nil {
+		return false, fmt.Errorf("no location resolver for \"%s\"", query)
+	}
+	if _, err := LocationResolver(query); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// resolveLocationInBackground resolves the location query in the background, once at a time per query.
+func resolveLocationInBackground(query string) {
+	key := normalizeLocationQuery(query)
+	pendingLocations.mu.Lock()
+	if pendingLocations.queries == nil {
+		pendingLocations.queries = map[string]struct{}{}
+	}
+	if _, ok := pendingLocations.queries[key]; ok {
+		pendingLocations.mu.Unlock()
+		return
+	}
+	pendingLocations.queries[key] = struct{}{}
+	pendingLocations.mu.Unlock()
+
+	go func() {
+		if _, err := ResolveLocationQuery(query); err != nil {
+			log.Printf("Unable to resolve the location \"%s\": %v", query, err)
+		}
+		pendingLocations.mu.Lock()
+		delete(pendingLocations.queries, key)
+		pendingLocations.mu.Unlock()
+	}()
+}
+
+// resolveLocationData fills the coordinates and time zone of data from the cached resolution of its query key.
+// Data that already has coordinates is left as is, and a time zone already set is kept.
+// A query not cached yet is resolved in the background and reported as an error meanwhile.
+func resolveLocationData(data map[string]interface{}, queryKey, latitudeKey, longitudeKey, timezoneKey string) error {
+	query, ok := data[queryKey].(string)
+	if !ok || query == "" {
+		return nil
+	}
+	_, hasLatitude := data[latitudeKey].(float64)
+	_, hasLongitude := data[longitudeKey].(float64)
+	if hasLatitude && hasLongitude {
+		return nil
+	}
+
+	location, ok := CachedLocation(query)
+	if !ok {
+		resolveLocationInBackground(query)
+		return fmt.Errorf("the location \"%s\" is being resolved", query)
+	}
+	data[latitudeKey] = location.Latitude
+	data[longitudeKey] = location.Longitude
+	if timezone, _ := data[timezoneKey].(string); timezone == "" && location.Timezone != "" {
+		data[timezoneKey] = location.Timezone
+	}
+	return nil
+}
+
+// locationQueries returns the location queries of the widget data: "location_query" and the "query" of each entry in "locations".
+func locationQueries(data map[string]interface{}) []string {
+	var queries []string
+	if query, ok := data["location_query"].(string); ok && query != "" {
+		queries = append(queries, query)
+	}
+	locations, _ := data["locations"].([]interface{})
+	for _, location := range locations {
+		locationData, _ := location.(map[string]interface{})
+		if query, ok := locationData["query"].(string); ok && query != "" {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// ResolveLayoutLocations resolves and caches the location queries of the widgets of the layout which are not cached yet.
+// It reports whether any of them was newly resolved.
+func ResolveLayoutLocations(l Layout) (bool, error) {
+	var errs []error
+	resolved := false
+	for _, widget := range l.AllWidgets() {
+		for _, query := range locationQueries(widget.Data) {
+			ok, err := ResolveLocationQuery(query)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to resolve \"%s\" of %s: %v", query, widget.GetId(), err))
+			}
+			resolved = resolved || ok
+		}
+	}
+	return resolved, errors.Join(errs...)
+}
+
+// ResolveAllLocations resolves the location queries of every layout in the background,
+// and tells the displays of a layout to reload once any of its locations is newly resolved.
+func ResolveAllLocations(hub *util.Hub) {
+	go func() {
+		names, err := LayoutNames()
+		if err != nil {
+			log.Printf("Failed to list the layouts to resolve their locations: %v", err)
+			return
+		}
+		for _, name := range names {
+			layout, err := loadLayout(name)
+			if err != nil {
+				continue
+			}
+			resolved, err := ResolveLayoutLocations(layout)
+			if err != nil {
+				log.Printf("Unable to resolve the locations of the layout %s: %v", name, err)
+			}
+			if resolved {
+				hub.Publish(RELOAD_EVENT, ReloadEvent{Layout: name, Full: true, WidgetIds: []string{}, WidgetTypes: []WidgetType{}})
+			}
+		}
+	}()
+}
+
+// ResolveLocations fills the coordinates of the location queries of the widget from the location cache.
+// Both "location_query" and the "query" of each entry in "locations" are filled.
+func (w *Widget) ResolveLocations() error {
+	if w.Data == nil {
+		return nil
+	}
+	if err := resolveLocationData(w.Data, "location_query", "location_latitude", "location_longitude", "location_timezone"); err != nil {
+		return err
+	}
+	if _, ok := w.Data["location_name"]; !ok {
+		if query, ok := w.Data["location_query"].(string); ok {
+			w.Data["location_name"] = query
+		}
+	}
+
+	locations, _ := w.Data["locations"].([]interface{})
+	for _, location := range locations {
+		locationData, ok := location.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := resolveLocationData(locationData, "query", "latitude", "longitude", "timezone"); err != nil {
+			return err
+		}
+		if _, ok := locationData["name"]; !ok {
+			locationData["name"] = locationData["query"]
+		}
+	}
+
+	// The widgets of a stack are resolved in the data of the stack.
+	children, _ := w.Data["widgets"].([]interface{})
+	for _, child := range children {
+		childData, ok := child.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		data, ok := childData["data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := (&Widget{Data: data}).ResolveLocations(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package layout
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Orientations of the screen a layout is rendered for.
+const (
+	ORIENTATION_LANDSCAPE = "landscape"
+	ORIENTATION_PORTRAIT  = "portrait"
+)
+
+// Grid represents the dimensions of a grid, such as the one of a layout on a portrait screen.
+type Grid struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+// hasPosition reports whether the widget has both a row and a column, given or placed.
+func (w Widget) hasPosition() bool {
+	return w.Row > 0 && w.Col > 0
+}
+
+// checkGrid returns an error unless the grid has rows and columns.
+func checkGrid(rows, cols int) error {
+	if rows <= 0 || cols <= 0 {
+		return fmt.Errorf("invalid grid of %dx%d", rows, cols)
+	}
+	return nil
+}
+
+// checkGrids returns the pages of the layout whose grid or portrait grid has no rows or columns.
+func (l Layout) checkGrids() error {
+	var errs []error
+	for _, page := range l.pages() {
+		if err := checkGrid(page.Rows, page.Cols); err != nil {
+			errs = append(errs, fmt.Errorf("page %s: %v", page.Name, err))
+		}
+		if page.Portrait != nil {
+			if err := checkGrid(page.Portrait.Rows, page.Portrait.Cols); err != nil {
+				errs = append(errs, fmt.Errorf("page %s: portrait %v", page.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PlaceWidgets places the widgets without a row or a column in the free cells of a grid of rows x cols.
+// They are placed by descending priority, then in their order, each at the first cells from the top left
+// that are free for its spans; a given row or column is kept. A widget that does not fit is left without a position,
+// as are all of them in a grid without rows or columns.
+func PlaceWidgets(widgets []Widget, rows, cols int) []Widget {
+	result := slices.Clone(widgets)
+	if checkGrid(rows, cols) != nil {
+		return result
+	}
+	occupied := make([][]bool, rows+1)
+	for row := range occupied {
+		occupied[row] = make([]bool, cols+1)
+	}
+	fits := func(row, col, rowSpan, colSpan int) bool {
+		if row+rowSpan-1 > rows || col+colSpan-1 > cols {
+			return false
+		}
+		for r := row; r < row+rowSpan; r++ {
+			for c := col; c < col+colSpan; c++ {
+				if occupied[r][c] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	occupy := func(row, col, rowSpan, colSpan int) {
+		for r := max(row, 1); r < row+rowSpan && r <= rows; r++ {
+			for c := max(col, 1); c < col+colSpan && c <= cols; c++ {
+				occupied[r][c] = true
+			}
+		}
+	}
+
+	// The widgets with a position are kept there, overlapping or not.
+	var pending []int
+	for i, widget := range result {
+		if !widget.hasPosition() {
+			pending = append(pending, i)
+			continue
+		}
+		rowSpan, colSpan := widget.Spans()
+		occupy(int(widget.Row), int(widget.Col), rowSpan, colSpan)
+	}
+	slices.SortStableFunc(pending, func(a, b int) int {
+		return cmp.Compare(result[b].Priority, result[a].Priority)
+	})
+
+	for _, i := range pending {
+		widget := &result[i]
+		rowSpan, colSpan := widget.Spans()
+	place_widgets_search:
+		for row := 1; row <= rows; row++ {
+			if widget.Row > 0 && int(widget.Row) != row {
+				continue
+			}
+			for col := 1; col <= cols; col++ {
+				if widget.Col > 0 && int(widget.Col) != col {
+					continue
+				}
+				if fits(row, col, rowSpan, colSpan) {
+					occupy(row, col, rowSpan, colSpan)
+					widget.Row, widget.Col = int64(row), int64(col)
+					break place_widgets_search
+				}
+			}
+		}
+	}
+	return result
+}
+
+// InOrientation returns the layout as rendered on a screen of the orientation.
+// In portrait, the pages with a portrait grid take its dimensions, and their widgets are all placed again
+// in the reading order of the landscape grid.
+func (l Layout) InOrientation(orientation string) Layout {
+	if orientation != ORIENTATION_PORTRAIT {
+		return l
+	}
+	oriented := l
+	oriented.Pages = l.pages()
+	for i, page := range oriented.Pages {
+		if page.Portrait == nil {
+			continue
+		}
+		// The widgets left out of the landscape grid come last.
+		page.Widgets = PlaceWidgets(page.Widgets, page.Rows, page.Cols)
+		slices.SortStableFunc(page.Widgets, func(a, b Widget) int {
+			if a.hasPosition() != b.hasPosition() {
+				if a.hasPosition() {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col), cmp.Compare(b.Priority, a.Priority))
+		})
+		page.Rows, page.Cols = page.Portrait.Rows, page.Portrait.Cols
+		// Clearing the priorities keeps PlaceWidgets from reordering the widgets again.
+		for j := range page.Widgets {
+			page.Widgets[j].Row, page.Widgets[j].Col = 0, 0
+			page.Widgets[j].Priority = 0
+		}
+		oriented.Pages[i] = page
+	}
+	return oriented
+}
+
+// HasPortrait reports whether a page of the layout has a portrait grid.
+func (l Layout) HasPortrait() bool {
+	return slices.ContainsFunc(l.pages(), func(page Page) bool { return page.Portrait != nil })
+}
@@ -0,0 +1,154 @@
+package layout
+
+import "testing"
+
+func TestPlaceWidgets(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      int
+		cols      int
+		widgets   []Widget
+		positions [][2]int64
+	}{
+		{
+			name: "fills from the top left around the placed widgets",
+			rows: 2, cols: 3,
+			widgets: []Widget{
+				{Size: Small, Row: 1, Col: 1},
+				{Size: MiddleH},
+				{Size: Small},
+			},
+			positions: [][2]int64{{1, 1}, {1, 2}, {2, 1}},
+		},
+		{
+			name: "places the higher priorities first",
+			rows: 2, cols: 2,
+			widgets: []Widget{
+				{Size: Small},
+				{Size: MiddleH, Priority: 1},
+			},
+			positions: [][2]int64{{2, 1}, {1, 1}},
+		},
+		{
+			name: "keeps the order among equal priorities",
+			rows: 1, cols: 3,
+			widgets: []Widget{
+				{Size: Small, Priority: 2},
+				{Size: Small},
+				{Size: Small, Priority: 2},
+			},
+			positions: [][2]int64{{1, 1}, {1, 3}, {1, 2}},
+		},
+		{
+			name: "keeps a given row",
+			rows: 3, cols: 2,
+			widgets: []Widget{
+				{Size: Small, Row: 3},
+				{Size: Small},
+			},
+			positions: [][2]int64{{3, 1}, {1, 1}},
+		},
+		{
+			name: "keeps a given column",
+			rows: 2, cols: 3,
+			widgets: []Widget{
+				{Size: Small, Row: 1, Col: 3},
+				{Size: Small, Col: 3},
+			},
+			positions: [][2]int64{{1, 3}, {2, 3}},
+		},
+		{
+			name: "leaves out a widget that does not fit",
+			rows: 2, cols: 2,
+			widgets: []Widget{
+				{Size: Small, Row: 1, Col: 2},
+				{Size: Large},
+				{Size: MiddleV},
+			},
+			positions: [][2]int64{{1, 2}, {0, 0}, {1, 1}},
+		},
+		{
+			name: "leaves a given row that is full without a column",
+			rows: 1, cols: 1,
+			widgets: []Widget{
+				{Size: Small, Row: 1, Col: 1},
+				{Size: Small, Row: 1},
+			},
+			positions: [][2]int64{{1, 1}, {1, 0}},
+		},
+		{
+			name: "places nothing in a grid without rows",
+			rows: -2, cols: 3,
+			widgets: []Widget{
+				{Size: Small, Row: 1, Col: 1},
+				{Size: Small},
+			},
+			positions: [][2]int64{{1, 1}, {0, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placed := PlaceWidgets(tt.widgets, tt.rows, tt.cols)
+			for i, widget := range placed {
+				if got := [2]int64{widget.Row, widget.Col}; got != tt.positions[i] {
+					t.Errorf("widget %d placed at %v, want %v", i, got, tt.positions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInOrientationReadingOrder(t *testing.T) {
+	layout := Layout{
+		Rows:     2,
+		Cols:     2,
+		Portrait: &Grid{Rows: 2, Cols: 1},
+		Widgets: []Widget{
+			{Type: ClockWidget, Size: Small, Row: 2, Col: 2, Data: map[string]interface{}{"name": "bottom right"}},
+			{Type: ClockWidget, Size: Small, Row: 1, Col: 1, Data: map[string]interface{}{"name": "top left"}},
+		},
+	}
+	want := map[string][2]int64{"top left": {1, 1}, "bottom right": {2, 1}}
+	for _, widget := range layout.InOrientation(ORIENTATION_PORTRAIT).GetPages()[0].Widgets {
+		name := widget.Data["name"].(string)
+		if got := [2]int64{widget.Row, widget.Col}; got != want[name] {
+			t.Errorf("%s placed at %v, want %v", name, got, want[name])
+		}
+	}
+	if layout.Widgets[0].Row != 2 || layout.Widgets[1].Row != 1 {
+		t.Errorf("InOrientation modified the widgets of the layout")
+	}
+}
+
+func TestInOrientationIgnoresPriority(t *testing.T) {
+	layout := Layout{
+		Rows:     1,
+		Cols:     2,
+		Portrait: &Grid{Rows: 2, Cols: 1},
+		Widgets: []Widget{
+			{Type: ClockWidget, Size: Small, Row: 1, Col: 1, Data: map[string]interface{}{"name": "clock"}},
+			{Type: NotionCalendarWidget, Size: Small, Row: 1, Col: 2, Priority: 5, Data: map[string]interface{}{"name": "calendar"}},
+		},
+	}
+	want := map[string][2]int64{"clock": {1, 1}, "calendar": {2, 1}}
+	for _, widget := range layout.InOrientation(ORIENTATION_PORTRAIT).GetPages()[0].Widgets {
+		name := widget.Data["name"].(string)
+		if got := [2]int64{widget.Row, widget.Col}; got != want[name] {
+			t.Errorf("%s placed at %v, want %v", name, got, want[name])
+		}
+	}
+	if layout.Widgets[1].Priority != 5 {
+		t.Errorf("InOrientation modified the widgets of the layout")
+	}
+}
+
+func TestValidateGrids(t *testing.T) {
+	layout := Layout{Name: "bad", Rows: 2, Cols: 2, Portrait: &Grid{Rows: -2, Cols: 1}}
+	if err := layout.checkGrids(); err == nil {
+		t.Errorf("checkGrids accepted a portrait grid of -2 rows")
+	}
+	pages := layout.InOrientation(ORIENTATION_PORTRAIT).GetPages()
+	if err := pages[0].CheckGrid(); err == nil {
+		t.Errorf("CheckGrid accepted a grid of -2 rows")
+	}
+}
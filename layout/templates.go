@@ -0,0 +1,87 @@
+package layout
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"sync"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+// templates holds the parsed template files by path, e.g. "widgets/clock.tmpl".
+// Every file is parsed into its own set, since the widget templates define the same size names.
+var (
+	templates      = map[string]*template.Template{}
+	pageTemplates  *template.Template
+	templateFS     fs.FS
+	templatesMutex sync.RWMutex
+)
+
+// TEMPLATE_PATTERNS are the template files parsed by LoadTemplates, besides the page templates.
+var TEMPLATE_PATTERNS = []string{"util.tmpl", "widgets/*.tmpl"}
+
+// PAGE_TEMPLATES are the templates of the whole pages, rendered by PageRender.
+var PAGE_TEMPLATES = []string{"index.tmpl", "error.tmpl"}
+
+// LoadTemplates parses the template files of fsys once, to be executed on every request.
+// On error, the templates loaded before are kept.
+func LoadTemplates(fsys fs.FS) error {
+	parsed := map[string]*template.Template{}
+	for _, pattern := range TEMPLATE_PATTERNS {
+		paths, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			tmpl, err := template.New(path).Funcs(template.FuncMap{"getIndexRange": GetIndexRange}).ParseFS(fsys, path)
+			if err != nil {
+				return fmt.Errorf("failed to parse the template %s: %v", path, err)
+			}
+			parsed[path] = tmpl
+		}
+	}
+	pages, err := template.ParseFS(fsys, PAGE_TEMPLATES...)
+	if err != nil {
+		return fmt.Errorf("failed to parse the page templates: %v", err)
+	}
+
+	templatesMutex.Lock()
+	templates = parsed
+	pageTemplates = pages
+	templateFS = fsys
+	templatesMutex.Unlock()
+	return nil
+}
+
+// ReloadTemplates parses the template files again from the file system given to LoadTemplates.
+func ReloadTemplates() error {
+	templatesMutex.RLock()
+	fsys := templateFS
+	templatesMutex.RUnlock()
+	if fsys == nil {
+		return fmt.Errorf("templates are not loaded")
+	}
+	return LoadTemplates(fsys)
+}
+
+// Template returns the parsed template file of the given path.
+func Template(path string) (*template.Template, error) {
+	templatesMutex.RLock()
+	defer templatesMutex.RUnlock()
+	tmpl, ok := templates[path]
+	if !ok {
+		return nil, fmt.Errorf("template %s is not loaded", path)
+	}
+	return tmpl, nil
+}
+
+// PageRender renders the page templates for gin, following the reloads of the templates.
+type PageRender struct{}
+
+// Instance returns the renderer of the named page template.
+func (PageRender) Instance(name string, data any) render.Render {
+	templatesMutex.RLock()
+	defer templatesMutex.RUnlock()
+	return render.HTML{Template: pageTemplates, Name: name, Data: data}
+}
@@ -0,0 +1,293 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kken7231/screensaver/util"
+)
+
+// RELOAD_DEBOUNCE is how long the watcher waits for the writes of an editor to settle before reloading.
+const RELOAD_DEBOUNCE = 300 * time.Millisecond
+
+// Events pushed to the displays when files are reloaded.
+const (
+	RELOAD_EVENT       = "reload"
+	RELOAD_ERROR_EVENT = "reloaderror"
+)
+
+// ReloadEvent represents a change of the layouts or templates pushed to the displays.
+// An empty layout concerns every layout; the displays reload the whole page when Full is set,
+// or else only the widgets listed by ID or by type.
+type ReloadEvent struct {
+	Layout      string       `json:"layout"`
+	Full        bool         `json:"full"`
+	WidgetIds   []string     `json:"widget_ids"`
+	WidgetTypes []WidgetType `json:"widget_types"`
+}
+
+// ReloadErrorEvent represents a file that failed to validate. An empty message means the file is valid again.
+type ReloadErrorEvent struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+// Watcher reloads the layouts and templates edited in the on-disk directories and pushes the changes to the displays.
+type Watcher struct {
+	hub          *util.Hub
+	templatesDir string
+	layoutsDir   string
+
+	layouts  map[string]Layout
+	mutex    sync.Mutex
+	failures map[string]string
+}
+
+// NewWatcher creates a Watcher of the templates and layouts directories, publishing to the hub.
+func NewWatcher(hub *util.Hub, templatesDir, layoutsDir string) *Watcher {
+	return &Watcher{
+		hub:          hub,
+		templatesDir: templatesDir,
+		layoutsDir:   layoutsDir,
+		layouts:      map[string]Layout{},
+		failures:     map[string]string{},
+	}
+}
+
+// Start watches the directories until the context is done.
+func (w *Watcher) Start(ctx context.Context) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	var watched []string
+	for _, dir := range []string{w.templatesDir, filepath.Join(w.templatesDir, "widgets"), w.layoutsDir} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err = fsWatcher.Add(dir); err != nil {
+			fsWatcher.Close()
+			return fmt.Errorf("failed to watch %s: %v", dir, err)
+		}
+		watched = append(watched, dir)
+	}
+	if len(watched) == 0 {
+		fsWatcher.Close()
+		return fmt.Errorf("none of the directories %s and %s exists", w.templatesDir, w.layoutsDir)
+	}
+
+	// Remember the current layouts to tell what an edit changes.
+	names, _ := LayoutNames()
+	for _, name := range names {
+		if layout, err := loadLayout(name); err == nil {
+			w.layouts[name] = layout
+		}
+	}
+
+	go w.run(ctx, fsWatcher)
+	log.Printf("Watching %s for changes", strings.Join(watched, ", "))
+	return nil
+}
+
+// run collects the changed files and reloads them once the writes settle.
+func (w *Watcher) run(ctx context.Context, fsWatcher *fsnotify.Watcher) {
+	defer fsWatcher.Close()
+	pending := map[string]struct{}{}
+	timer := time.NewTimer(RELOAD_DEBOUNCE)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			pending[event.Name] = struct{}{}
+			timer.Reset(RELOAD_DEBOUNCE)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v", err)
+		case <-timer.C:
+			templatesChanged := []string{}
+			for path := range pending {
+				if rel, ok := relativeTo(w.templatesDir, path); ok && strings.HasSuffix(rel, ".tmpl") {
+					templatesChanged = append(templatesChanged, rel)
+				} else if rel, ok := relativeTo(w.layoutsDir, path); ok && strings.HasSuffix(rel, ".json") && !strings.Contains(rel, "/") {
+					w.reloadLayout(strings.TrimSuffix(rel, ".json"))
+				}
+			}
+			if len(templatesChanged) > 0 {
+				w.reloadTemplates(templatesChanged)
+			}
+			clear(pending)
+		}
+	}
+}
+
+// relativeTo returns the slash-separated path of path inside dir, if it is inside.
+func relativeTo(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// reloadTemplates parses the templates again and tells the displays which widget types to reload.
+func (w *Watcher) reloadTemplates(changed []string) {
+	const file = "templates"
+	if err := ReloadTemplates(); err != nil {
+		log.Printf("Keeping the previous templates: %v", err)
+		w.fail(file, err.Error())
+		return
+	}
+	w.fail(file, "")
+
+	event := ReloadEvent{WidgetIds: []string{}, WidgetTypes: []WidgetType{}}
+	for _, path := range changed {
+		if widgetTemplate, ok := strings.CutPrefix(path, "widgets/"); ok {
+			event.WidgetTypes = append(event.WidgetTypes, WidgetType(strings.TrimSuffix(widgetTemplate, ".tmpl")))
+		} else {
+			event.Full = true
+		}
+	}
+	log.Printf("Reloaded the templates %s", strings.Join(changed, ", "))
+	w.hub.Publish(RELOAD_EVENT, event)
+}
+
+// reloadLayout loads the layout again, validates it and tells its displays what changed.
+func (w *Watcher) reloadLayout(name string) {
+	file := name + ".json"
+	layout, err := loadLayout(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		delete(w.layouts, name)
+		w.fail(file, "")
+		w.hub.Publish(RELOAD_EVENT, ReloadEvent{Layout: name, Full: true, WidgetIds: []string{}, WidgetTypes: []WidgetType{}})
+		return
+	}
+	if err != nil {
+		log.Printf("Keeping the previous layout %s: %v", name, err)
+		w.fail(file, fmt.Sprintf("%s: %v", file, err))
+		return
+	}
+
+	// Resolve the new locations before validating, so that the widgets render with their coordinates.
+	resolved, err := ResolveLayoutLocations(layout)
+	if err != nil {
+		log.Printf("Unable to resolve the locations of the layout %s: %v", name, err)
+	}
+
+	// Widgets failing validation are still shown, as error cards.
+	if err = ValidateLayout(name); err != nil {
+		w.fail(file, fmt.Sprintf("%s: %s", file, strings.ReplaceAll(err.Error(), "\n", "; ")))
+	} else {
+		w.fail(file, "")
+	}
+
+	event := ReloadEvent{Layout: name, WidgetIds: []string{}, WidgetTypes: []WidgetType{}}
+	previous, ok := w.layouts[name]
+	if ok {
+		event.Full, event.WidgetIds = diffLayouts(previous, layout)
+	}
+	if !ok || resolved {
+		event.Full = true
+	}
+	w.layouts[name] = layout
+	if event.Full || len(event.WidgetIds) > 0 {
+		log.Printf("Reloaded the layout %s", name)
+		w.hub.Publish(RELOAD_EVENT, event)
+	}
+}
+
+// diffLayouts returns whether the grid or the pages of the layout changed in either orientation,
+// or else the IDs of the widgets whose data changed.
+func diffLayouts(previous, layout Layout) (bool, []string) {
+	changed := []string{}
+	if previous.HasPortrait() != layout.HasPortrait() {
+		return true, changed
+	}
+	for _, orientation := range []string{ORIENTATION_LANDSCAPE, ORIENTATION_PORTRAIT} {
+		full, ids := diffPages(previous.InOrientation(orientation), layout.InOrientation(orientation))
+		if full {
+			return true, []string{}
+		}
+		for _, id := range ids {
+			if !slices.Contains(changed, id) {
+				changed = append(changed, id)
+			}
+		}
+	}
+	return false, changed
+}
+
+// diffPages returns whether the grid or the pages of the layout changed, or else the IDs of the widgets whose data changed.
+func diffPages(previous, layout Layout) (bool, []string) {
+	changed := []string{}
+	previousPages, pages := previous.GetPages(), layout.GetPages()
+	if len(previousPages) != len(pages) || previous.Transition != layout.Transition {
+		return true, changed
+	}
+	for i, page := range pages {
+		old := previousPages[i]
+		if old.Rows != page.Rows || old.Cols != page.Cols || old.Dwell != page.Dwell || len(old.Widgets) != len(page.Widgets) {
+			return true, []string{}
+		}
+	}
+	widgets := map[string]Widget{}
+	for _, widget := range previous.AllWidgets() {
+		widgets[widget.GetId()] = widget
+	}
+	for _, widget := range layout.AllWidgets() {
+		old, ok := widgets[widget.GetId()]
+		oldRows, oldCols := old.Spans()
+		rows, cols := widget.Spans()
+		if !ok || old.Variant() != widget.Variant() || oldRows != rows || oldCols != cols {
+			return true, []string{}
+		}
+		if !reflect.DeepEqual(old.Data, widget.Data) {
+			changed = append(changed, widget.GetId())
+		}
+	}
+	return false, changed
+}
+
+// fail records the validation error of the file, or clears it when the message is empty, and pushes it to the displays.
+func (w *Watcher) fail(file, message string) {
+	w.mutex.Lock()
+	previous := w.failures[file]
+	if message == "" {
+		delete(w.failures, file)
+	} else {
+		w.failures[file] = message
+	}
+	w.mutex.Unlock()
+	if message != previous {
+		w.hub.Publish(RELOAD_ERROR_EVENT, ReloadErrorEvent{File: file, Message: message})
+	}
+}
+
+// Failures returns the current validation errors by file, to be shown to the displays connecting later.
+func (w *Watcher) Failures() map[string]string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return maps.Clone(w.failures)
+}
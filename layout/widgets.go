@@ -3,9 +3,11 @@ package layout
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
+	"math"
 	"slices"
 
 	"github.com/gin-gonic/gin"
@@ -24,38 +26,136 @@ const (
 	LongV   WidgetSize = "longv"
 )
 
+// MAX_SPAN is the largest number of rows or columns a widget without limits of its own can span.
+const MAX_SPAN = 12
+
+// SizeSpans returns the rows and columns spanned by a named size.
+func SizeSpans(size WidgetSize) (int, int) {
+	switch size {
+	case MiddleH:
+		return 1, 2
+	case MiddleV:
+		return 2, 1
+	case Large:
+		return 2, 2
+	case LongH:
+		return 1, 4
+	case LongV:
+		return 4, 1
+	}
+	return 1, 1
+}
+
 // Widget represents the structure of a widget with its type, size, position, and data.
+// RowSpan and ColSpan override the rows and columns spanned by its size.
+// A widget without a row or a column is placed by PlaceWidgets, the ones of higher Priority first.
 type Widget struct {
-	Type WidgetType             `json:"type"`
-	Size WidgetSize             `json:"size"`
-	Row  int64                  `json:"row"`
-	Col  int64                  `json:"col"`
-	Data map[string]interface{} `json:"data"`
+	Type     WidgetType             `json:"type"`
+	Size     WidgetSize             `json:"size"`
+	Row      int64                  `json:"row"`
+	Col      int64                  `json:"col"`
+	RowSpan  int                    `json:"rowSpan"`
+	ColSpan  int                    `json:"colSpan"`
+	Priority int                    `json:"priority"`
+	Data     map[string]interface{} `json:"data"`
+
+	// Page is the index of the page of the carousel holding the widget.
+	Page int `json:"-"`
+	// Parent is the ID of the stack holding the widget, and Index its position in the stack.
+	Parent string `json:"-"`
+	Index  int    `json:"-"`
 }
 
-// GetId returns a unique identifier for the widget based on its type, row, and column.
+// GetId returns a unique identifier for the widget based on its type, row, and column,
+// and its page from the second page of a carousel on. A widget of a stack is identified by its position in the stack.
 func (w Widget) GetId() string {
+	if w.Parent != "" {
+		return fmt.Sprintf("%s-s%d-%s", w.Parent, w.Index+1, w.Type)
+	}
+	if w.Page > 0 {
+		return fmt.Sprintf("wg-p%d-%s-r%d-c%d", w.Page+1, w.Type, w.Row, w.Col)
+	}
 	return fmt.Sprintf("wg-%s-r%d-c%d", w.Type, w.Row, w.Col)
 }
 
+// Spans returns the rows and columns spanned by the widget, from its rowSpan and colSpan or else its size.
+func (w Widget) Spans() (int, int) {
+	rows, cols := SizeSpans(w.Size)
+	if w.RowSpan > 0 {
+		rows = w.RowSpan
+	}
+	if w.ColSpan > 0 {
+		cols = w.ColSpan
+	}
+	return rows, cols
+}
+
+// Variant returns the size whose template renders the widget: its size, or else the supported size
+// closest to the aspect ratio of its spans, the closest in area breaking ties.
+func (w Widget) Variant() WidgetSize {
+	if w.Size != "" {
+		return w.Size
+	}
+	rows, cols := w.Spans()
+	var variant WidgetSize
+	bestRatio, bestArea := math.Inf(1), math.Inf(1)
+	for _, size := range SupportedSizes(w.Type) {
+		sizeRows, sizeCols := SizeSpans(size)
+		ratio := math.Abs(math.Log(float64(cols*sizeRows) / float64(rows*sizeCols)))
+		area := math.Abs(float64(rows*cols - sizeRows*sizeCols))
+		if ratio < bestRatio || (ratio == bestRatio && area < bestArea) {
+			variant, bestRatio, bestArea = size, ratio, area
+		}
+	}
+	return variant
+}
+
 // RenderFromTemplate renders the widget using the specified template name.
-func (w Widget) RenderFromTemplate(tmplName string) string {
-	if !SizeCheck(w.Type, w.Size) {
-		log.Printf("Invalid size %s for %s Widget", w.Size, tmplName)
-		return ""
+func (w Widget) RenderFromTemplate(tmplName string) (string, error) {
+	size := w.Variant()
+	if !SizeCheck(w.Type, size) {
+		return "", fmt.Errorf("invalid size %s for %s Widget", size, tmplName)
 	}
-	tmpl, err := template.New(tmplName).Funcs(template.FuncMap{"getIndexRange": GetIndexRange}).ParseFiles(fmt.Sprintf("templates/widgets/%s.tmpl", tmplName))
+	if rows, cols := w.Spans(); !SpanCheck(w.Type, rows, cols) {
+		limits := SpanLimits(w.Type)
+		return "", fmt.Errorf("invalid span %dx%d for %s Widget, which spans %d-%d rows and %d-%d columns",
+			rows, cols, tmplName, limits.MinRows, limits.MaxRows, limits.MinCols, limits.MaxCols)
+	}
+	tmpl, err := Template(fmt.Sprintf("widgets/%s.tmpl", tmplName))
 	if err != nil {
-		log.Fatalf("Failed to find a template for %s %s Widget: %v", w.Size, tmplName, err)
-		return ""
+		return "", fmt.Errorf("failed to find a template for %s %s Widget: %v", size, tmplName, err)
 	}
-	var buf bytes.Buffer
-	err = tmpl.ExecuteTemplate(&buf, string(w.Size), gin.H{
+	data := gin.H{
 		"widgetId": w.GetId(),
-	})
+	}
+	// Clocks are rendered client-side with the options of the layout.
+	if w.Type == ClockWidget {
+		data["clock"], err = w.ParseClockOptions()
+		if err != nil {
+			return "", fmt.Errorf("invalid options for %s: %v", w.GetId(), err)
+		}
+	}
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, string(size), data)
 	if err != nil {
-		log.Fatalf("Template execution failed for %s %s Widget: %v", w.Size, tmplName, err)
-		return ""
+		return "", fmt.Errorf("template execution failed for %s %s Widget: %v", size, tmplName, err)
+	}
+	return buf.String(), nil
+}
+
+// RenderError renders the error card shown in place of a widget that failed to render.
+func RenderError(widgetId string, message string) string {
+	var buf bytes.Buffer
+	tmpl, err := Template("util.tmpl")
+	if err == nil {
+		err = tmpl.ExecuteTemplate(&buf, "errorcard", gin.H{
+			"widgetId": widgetId,
+			"message":  message,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to render the error card of %s: %v", widgetId, err)
+		return template.HTMLEscapeString(message)
 	}
 	return buf.String()
 }
@@ -74,13 +174,111 @@ type WidgetType string
 
 // Constants for different widget types.
 const (
-	WeatherForecastWidget WidgetType = "weatherforecast"
-	NotionCalendarWidget  WidgetType = "notioncalendar"
-	ClockWidget           WidgetType = "clock"
+	WeatherForecastWidget  WidgetType = "weatherforecast"
+	NotionCalendarWidget   WidgetType = "notioncalendar"
+	ClockWidget            WidgetType = "clock"
+	WeatherHistoryWidget   WidgetType = "weatherhistory"
+	ForecastAccuracyWidget WidgetType = "forecastaccuracy"
+	RainAlertWidget        WidgetType = "rainalert"
+	WeatherCompareWidget   WidgetType = "weathercompare"
+	WeatherWarningsWidget  WidgetType = "weatherwarnings"
+	QuakeWidget            WidgetType = "quake"
+	AdviceWidget           WidgetType = "advice"
+	AirQualityWidget       WidgetType = "airquality"
+	SkyWidget              WidgetType = "sky"
+	StackWidget            WidgetType = "stack"
 )
 
+// STACK_INTERVAL is how many seconds a stack shows each of its widgets when its data does not set it.
+const STACK_INTERVAL = 15
+
+// QUAKE_INTENSITIES are the JMA seismic intensities accepted as "quake_intensity", from the weakest.
+var QUAKE_INTENSITIES = []string{"1", "2", "3", "4", "5-", "5+", "6-", "6+", "7"}
+
+// Children returns the widgets of a stack, placed in the cell and spans of the stack.
+// A widget without a size takes the size of the stack, or else the variant closest to the spans of the stack.
+// It returns no widgets for the other types.
+func (w Widget) Children() ([]Widget, error) {
+	var children []Widget
+	if w.Type != StackWidget {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(w.Data["widgets"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid widgets of %s: %v", w.GetId(), err)
+	}
+	if err = json.Unmarshal(encoded, &children); err != nil {
+		return nil, fmt.Errorf("invalid widgets of %s: %v", w.GetId(), err)
+	}
+	if len(children) == 0 {
+		return nil, fmt.Errorf("%s has no widgets", w.GetId())
+	}
+	for i := range children {
+		child := &children[i]
+		if child.Type == StackWidget {
+			return nil, fmt.Errorf("%s cannot hold another stack", w.GetId())
+		}
+		if child.Size == "" {
+			child.Size = w.Size
+		}
+		if w.Size != "" && child.Size != w.Size {
+			return nil, fmt.Errorf("widget %d of %s is %s, not the size of the stack %s", i+1, w.GetId(), child.Size, w.Size)
+		}
+		child.RowSpan, child.ColSpan = w.Spans()
+		child.Row = w.Row
+		child.Col = w.Col
+		child.Page = w.Page
+		child.Parent = w.GetId()
+		child.Index = i
+	}
+	return children, nil
+}
+
+// RenderStack renders the widgets of a stack, each rotated in turn in the cell of the stack.
+// A widget failing to render is replaced by an error card.
+func (w Widget) RenderStack() (string, error) {
+	children, err := w.Children()
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := Template("widgets/stack.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a template for stack Widget: %v", err)
+	}
+	interval, ok := w.Data["stack_interval"].(float64)
+	if !ok {
+		interval = STACK_INTERVAL
+	}
+	var items []gin.H
+	for _, child := range children {
+		content, err := child.render()
+		if err != nil {
+			log.Printf("Unable to render %s: %v", child.GetId(), err)
+			content = RenderError(child.GetId(), err.Error())
+		}
+		items = append(items, gin.H{
+			"showUpdateBtn":   err == nil && ShowUpdateBtn(child.Type),
+			"refreshInterval": RefreshInterval(child.Type),
+			"wgcontent":       template.HTML(content),
+			"widgetId":        child.GetId(),
+			"wgquery":         fmt.Sprintf("size=%s&%s", child.Variant(), mapToQueryString(child.Data)),
+			"wgtype":          child.Type,
+		})
+	}
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, "stack", gin.H{
+		"widgetId": w.GetId(),
+		"interval": interval,
+		"items":    items,
+	})
+	if err != nil {
+		return "", fmt.Errorf("template execution failed for stack Widget: %v", err)
+	}
+	return buf.String(), nil
+}
+
 // RenderContent renders the content of the widget based on its type.
-func (w Widget) RenderContent() string {
+func (w Widget) RenderContent() (string, error) {
 	switch w.Type {
 	case WeatherForecastWidget:
 		return w.RenderFromTemplate("weatherforecast")
@@ -88,14 +286,34 @@ func (w Widget) RenderContent() string {
 		return w.RenderFromTemplate("notioncalendar")
 	case ClockWidget:
 		return w.RenderFromTemplate("clock")
+	case WeatherHistoryWidget:
+		return w.RenderFromTemplate("weatherhistory")
+	case ForecastAccuracyWidget:
+		return w.RenderFromTemplate("forecastaccuracy")
+	case RainAlertWidget:
+		return w.RenderFromTemplate("rainalert")
+	case WeatherCompareWidget:
+		return w.RenderFromTemplate("weathercompare")
+	case WeatherWarningsWidget:
+		return w.RenderFromTemplate("weatherwarnings")
+	case QuakeWidget:
+		return w.RenderFromTemplate("quake")
+	case AdviceWidget:
+		return w.RenderFromTemplate("advice")
+	case AirQualityWidget:
+		return w.RenderFromTemplate("airquality")
+	case SkyWidget:
+		return w.RenderFromTemplate("sky")
+	case StackWidget:
+		return w.RenderStack()
 	}
-	return "Not Implemented"
+	return "", fmt.Errorf("widget type %s is not implemented", w.Type)
 }
 
 // DataCheck validates the data of the widget based on its type.
 func (w Widget) DataCheck() bool {
 	switch w.Type {
-	case WeatherForecastWidget:
+	case WeatherForecastWidget, RainAlertWidget, AdviceWidget, AirQualityWidget, SkyWidget:
 		check := true
 		_, ok := w.Data["location_name"].(string)
 		check = check && ok
@@ -110,23 +328,158 @@ func (w Widget) DataCheck() bool {
 		// check = check && ok
 		return check
 	case ClockWidget:
-		return true
+		_, err := w.ParseClockOptions()
+		return err == nil
+	case WeatherHistoryWidget:
+		check := true
+		_, ok := w.Data["location_name"].(string)
+		check = check && ok
+		_, ok = w.Data["location_histdata"].(string)
+		check = check && ok
+		return check
+	case ForecastAccuracyWidget:
+		check := true
+		_, ok := w.Data["location_name"].(string)
+		check = check && ok
+		_, ok = w.Data["location_histdata"].(string)
+		check = check && ok
+		return check
+	case WeatherCompareWidget:
+		locations, ok := w.Data["locations"].([]interface{})
+		check := ok && len(locations) > 0
+		for _, location := range locations {
+			locationData, ok := location.(map[string]interface{})
+			check = check && ok
+			_, ok = locationData["name"].(string)
+			check = check && ok
+			_, ok = locationData["latitude"].(float64)
+			check = check && ok
+			_, ok = locationData["longitude"].(float64)
+			check = check && ok
+		}
+		return check
+	case WeatherWarningsWidget:
+		check := true
+		_, ok := w.Data["location_name"].(string)
+		check = check && ok
+		_, ok = w.Data["warning_area"].(string)
+		check = check && ok
+		if office, ok := w.Data["warning_office"]; ok {
+			_, ok = office.(string)
+			check = check && ok
+		}
+		return check
+	case QuakeWidget:
+		// Every field is optional; the watched areas and threshold only drive the overlay.
+		check := true
+		if areas, ok := w.Data["quake_areas"]; ok {
+			// The area codes are strings, as numbers would drop the leading zero of codes such as "01".
+			codes, ok := areas.([]interface{})
+			check = check && ok
+			for _, code := range codes {
+				_, ok = code.(string)
+				check = check && ok
+			}
+		}
+		if intensity, ok := w.Data["quake_intensity"]; ok {
+			intensity_str, ok := intensity.(string)
+			check = check && ok && slices.Contains(QUAKE_INTENSITIES, intensity_str)
+		}
+		return check
+	case StackWidget:
+		_, err := w.Children()
+		check := err == nil
+		if interval, ok := w.Data["stack_interval"]; ok {
+			seconds, ok := interval.(float64)
+			check = check && ok && seconds > 0
+		}
+		return check
 	}
 	return false
 }
 
-// SizeCheck validates if the widget size is supported for the given widget type.
-func SizeCheck(wgtype WidgetType, size WidgetSize) bool {
+// SupportedSizes returns the sizes whose templates the given widget type provides.
+func SupportedSizes(wgtype WidgetType) []WidgetSize {
 	var supportedSize []WidgetSize
 	switch wgtype {
 	case WeatherForecastWidget:
-		supportedSize = []WidgetSize{Small, MiddleV}
+		supportedSize = []WidgetSize{Small, MiddleV, Large}
 	case NotionCalendarWidget:
 		supportedSize = []WidgetSize{MiddleV, LongV, MiddleH}
 	case ClockWidget:
-		supportedSize = []WidgetSize{MiddleH}
+		supportedSize = []WidgetSize{Small, MiddleH, LongH, Large}
+	case WeatherHistoryWidget:
+		supportedSize = []WidgetSize{MiddleH, LongH}
+	case ForecastAccuracyWidget:
+		supportedSize = []WidgetSize{Small, MiddleH}
+	case RainAlertWidget:
+		supportedSize = []WidgetSize{Small, MiddleH}
+	case WeatherCompareWidget:
+		supportedSize = []WidgetSize{LongH, Large}
+	case WeatherWarningsWidget:
+		supportedSize = []WidgetSize{Small, MiddleH}
+	case QuakeWidget:
+		supportedSize = []WidgetSize{MiddleH, LongV}
+	case AdviceWidget:
+		supportedSize = []WidgetSize{Small, MiddleH}
+	case AirQualityWidget:
+		supportedSize = []WidgetSize{Small, MiddleH}
+	case SkyWidget:
+		supportedSize = []WidgetSize{Small, MiddleH}
+	case StackWidget:
+		supportedSize = []WidgetSize{Small, MiddleH, MiddleV, Large, LongH, LongV}
 	}
-	return slices.Contains(supportedSize, size)
+	return supportedSize
+}
+
+// SizeCheck validates if the widget size is supported for the given widget type.
+func SizeCheck(wgtype WidgetType, size WidgetSize) bool {
+	return slices.Contains(SupportedSizes(wgtype), size)
+}
+
+// SpanRange represents the smallest and largest numbers of rows and columns a widget type can span.
+type SpanRange struct {
+	MinRows int
+	MaxRows int
+	MinCols int
+	MaxCols int
+}
+
+// SpanLimits returns the spans supported by the given widget type.
+func SpanLimits(wgtype WidgetType) SpanRange {
+	switch wgtype {
+	case WeatherForecastWidget:
+		return SpanRange{1, 4, 1, 3}
+	case NotionCalendarWidget:
+		return SpanRange{1, 6, 1, 4}
+	case ClockWidget:
+		return SpanRange{1, 3, 1, 6}
+	case WeatherHistoryWidget:
+		return SpanRange{1, 2, 2, 6}
+	case ForecastAccuracyWidget:
+		return SpanRange{1, 2, 1, 3}
+	case RainAlertWidget:
+		return SpanRange{1, 2, 1, 3}
+	case WeatherCompareWidget:
+		return SpanRange{1, 3, 2, 6}
+	case WeatherWarningsWidget:
+		return SpanRange{1, 2, 1, 3}
+	case QuakeWidget:
+		return SpanRange{1, 4, 1, 3}
+	case AdviceWidget:
+		return SpanRange{1, 2, 1, 3}
+	case AirQualityWidget:
+		return SpanRange{1, 2, 1, 3}
+	case SkyWidget:
+		return SpanRange{1, 2, 1, 3}
+	}
+	return SpanRange{1, MAX_SPAN, 1, MAX_SPAN}
+}
+
+// SpanCheck validates if the widget spans are supported for the given widget type.
+func SpanCheck(wgtype WidgetType, rows, cols int) bool {
+	limits := SpanLimits(wgtype)
+	return rows >= limits.MinRows && rows <= limits.MaxRows && cols >= limits.MinCols && cols <= limits.MaxCols
 }
 
 // ShowUpdateBtn determines if the update button should be shown for the given widget type.
@@ -138,6 +491,45 @@ func ShowUpdateBtn(wgtype WidgetType) bool {
 		return true
 	case ClockWidget:
 		return false
+	case WeatherHistoryWidget:
+		return true
+	case ForecastAccuracyWidget:
+		return true
+	case RainAlertWidget:
+		return true
+	case WeatherCompareWidget:
+		return true
+	case WeatherWarningsWidget:
+		return true
+	case QuakeWidget:
+		return true
+	case AdviceWidget:
+		return true
+	case AirQualityWidget:
+		return true
+	case SkyWidget:
+		return true
+	case StackWidget:
+		return false
 	}
 	return true
 }
+
+// RefreshInterval returns the interval in seconds at which the widget data is refreshed, or 0 for no refresh.
+func RefreshInterval(wgtype WidgetType) int {
+	switch wgtype {
+	case RainAlertWidget:
+		return 5 * 60
+	case WeatherWarningsWidget:
+		return 10 * 60
+	case QuakeWidget:
+		return 60
+	case AdviceWidget:
+		return 30 * 60
+	case AirQualityWidget:
+		return 30 * 60
+	case SkyWidget:
+		return 10 * 60
+	}
+	return 0
+}
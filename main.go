@@ -2,39 +2,157 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/kken7231/screensaver/config"
+	"github.com/kken7231/screensaver/display"
+	"github.com/kken7231/screensaver/jpcal"
 	"github.com/kken7231/screensaver/layout"
+	"github.com/kken7231/screensaver/notion"
+	"github.com/kken7231/screensaver/util"
+	"github.com/kken7231/screensaver/weather"
 
 	"github.com/gin-gonic/gin"
 )
 
 // main function sets up the Gin router, registers routes, and starts the server.
 func main() {
+	// Load the configuration from the file, the environment and the flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	// Use the embedded templates, static files and layouts unless overridden on disk
+	assets := NewAssets(cfg)
+	layout.Configure(cfg, assets.Layouts)
+
+	// Parse the templates once
+	if err = layout.LoadTemplates(assets.Templates); err != nil {
+		log.Fatalf("Failed to load the templates: %v", err)
+	}
+
+	// Reload the layouts and templates edited on disk and push the changes to the displays
+	hub := util.NewHub()
+	watcher := layout.NewWatcher(hub, cfg.Paths.Templates, cfg.Paths.Layouts)
+	if err = watcher.Start(context.Background()); err != nil {
+		log.Printf("Hot reload is disabled: %v", err)
+	}
+
 	// Create a default Gin router
 	router := gin.Default()
 
-	// Load HTML templates
-	router.LoadHTMLGlob("templates/index.tmpl")
+	// Render HTML pages from the loaded templates
+	router.HTMLRender = layout.PageRender{}
+
+	// Keep track of the displays and of the layouts assigned to them
+	registry := display.NewRegistry(filepath.Join(cfg.Paths.Data, "displays.json"))
+
+	// Switch the layouts of the displays by their schedules
+	scheduler := display.NewScheduler(registry)
+	layoutNames, err := layout.LayoutNames()
+	if err == nil {
+		err = scheduler.LoadSchedule(cfg.Schedule.Rules, layoutNames)
+	}
+	if err != nil {
+		log.Printf("Layouts are not scheduled: %v", err)
+	}
+	scheduler.Start(context.Background())
 
 	// Route for the main page
 	router.GET("/", func(c *gin.Context) {
-		// Get the layout name from query parameters
+		// Get the layout name from query parameters, unless one is assigned to the display or scheduled for it
+		client_id := registry.ClientID(c)
 		layout_name := c.Query("layout")
+		if assigned := registry.AssignedLayout(client_id); assigned != "" {
+			layout_name = assigned
+		} else if scheduled, ok := scheduler.Active(client_id, time.Now()); ok {
+			layout_name = scheduled.Layout
+		}
 		// Render the HTML page with the specified layout
-		c.HTML(http.StatusOK, "index.tmpl", layout.GetLayout(layout_name))
+		data, err := layout.GetLayout(layout_name, c.Query("orientation"))
+		if err != nil {
+			// List the available layouts instead, with 404 for an unknown name
+			status := http.StatusInternalServerError
+			if errors.Is(err, fs.ErrNotExist) {
+				status = http.StatusNotFound
+			}
+			layoutNames, listErr := layout.LayoutNames()
+			if listErr != nil {
+				log.Printf("Unable to list the layouts: %v", listErr)
+			}
+			if layout_name == "" {
+				layout_name = "default"
+			}
+			c.HTML(status, "error.tmpl", gin.H{
+				"status":     status,
+				"message":    err.Error(),
+				"layouts":    layoutNames,
+				"layoutName": layout_name,
+				"clientId":   client_id,
+			})
+			return
+		}
+		data["clientId"] = client_id
+		c.HTML(http.StatusOK, "index.tmpl", data)
 	})
 
 	// Serve static files
-	router.StaticFile("/design", "static/design.html")
-	router.StaticFile("/layouts", "static/layouts.html")
-	router.StaticFile("/tailwind.css", "static/tailwind.css")
-	router.StaticFile("/index.js", "static/js/index.js")
-	router.Static("/static/packages", "static/packages")
+	staticFS := http.FS(assets.Static)
+	router.StaticFileFS("/design", "design.html", staticFS)
+	router.StaticFileFS("/layouts", "layouts.html", staticFS)
+	router.StaticFileFS("/tailwind.css", "tailwind.css", staticFS)
+	router.StaticFileFS("/index.js", "js/index.js", staticFS)
+	packagesFS, err := fs.Sub(assets.Static, "packages")
+	if err != nil {
+		log.Fatalf("Failed to find the static packages: %v", err)
+	}
+	router.StaticFS("/static/packages", http.FS(packagesFS))
+
+	// Share one HTTP client with timeouts among all data fetchers
+	client := util.NewHTTPClient()
+
+	// Resolve location queries of the layouts into coordinates
+	layout.LocationResolver = func(query string) (layout.ResolvedLocation, error) {
+		return weather.ResolveLocation(context.Background(), client, query)
+	}
+	layout.ResolveAllLocations(hub)
+
+	// Collect AMeDAS observations in the background
+	historyStore := weather.NewHistoryStore(filepath.Join(cfg.Paths.Data, "amedas"))
+	weather.StartAmedasCollector(context.Background(), client, historyStore, weather.AMEDAS_COLLECT_INTERVAL)
+
+	// Track the accuracy of the forecasts in the background
+	forecastTracker := weather.NewForecastTracker(filepath.Join(cfg.Paths.Data, "forecasts"))
+	weather.StartForecastCollector(context.Background(), client, forecastTracker, weather.FORECAST_COLLECT_INTERVAL)
+
+	// Fetch the recent earthquakes in the background
+	quakeFeed := weather.NewQuakeFeed()
+	weather.StartQuakeCollector(context.Background(), client, quakeFeed, weather.QUAKE_COLLECT_INTERVAL)
+
+	// Load the thresholds of the lifestyle indices
+	adviceRules, err := weather.LoadAdviceRules(cfg.Weather.AdviceRules)
+	if err != nil {
+		log.Printf("Using the default advice rules: %v", err)
+	}
+
+	// Show the national holidays alongside the events of the Notion database, if configured
+	calendarSources := []notion.CalendarSource{jpcal.HolidaySource{}}
+	if cfg.Notion.Enabled() {
+		calendarSources = append(calendarSources, notion.NewNotionSource(client, cfg.Notion))
+	}
 
 	// Register API routes
-	RegisterApiRoutes(router)
+	RegisterApiRoutes(router, client, historyStore, forecastTracker, quakeFeed, adviceRules, calendarSources, hub, watcher, registry)
+	RegisterAdminRoutes(router, registry, scheduler, cfg.Admin.Token)
 
-	// Start the server on port 8080
-	router.Run(":8080") // Default port for Gin applications
+	// Start the server on the configured port
+	router.Run(fmt.Sprintf(":%d", cfg.Server.Port))
 }
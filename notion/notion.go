@@ -4,17 +4,19 @@ package notion
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"regexp"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/kken7231/screensaver/config"
 	"github.com/kken7231/screensaver/layout"
-	"github.com/kken7231/screensaver/util"
 
 	"github.com/gin-gonic/gin"
 )
@@ -143,11 +145,12 @@ type URLObj string
 
 // RawEvent represents an event with raw data.
 type RawEvent struct {
-	Name     string
-	Start    time.Time
-	End      time.Time
-	IsAllDay bool
-	Level    int
+	Name      string
+	Start     time.Time
+	End       time.Time
+	IsAllDay  bool
+	IsHoliday bool
+	Level     int
 }
 
 // Event represents a structured event.
@@ -159,6 +162,7 @@ type Event struct {
 	Level     int    `json:"level"`
 	Color     string `json:"color"`
 	IsAllDay  bool   `json:"is_all_day"`
+	IsHoliday bool   `json:"is_holiday"`
 }
 
 // CalendarData represents the structured calendar data.
@@ -208,13 +212,58 @@ func HierarchizeEvents(events *[]RawEvent) {
 	*events = eventsProcessed
 }
 
+// CalendarSource provides the events of a day from a calendar.
+type CalendarSource interface {
+	Events(ctx context.Context, day time.Time) ([]RawEvent, error)
+}
+
+// NotionSource is the calendar source of the Notion database.
+type NotionSource struct {
+	client *http.Client
+	cfg    config.NotionConfig
+}
+
+// NewNotionSource creates the calendar source of the configured Notion database queried with the client.
+func NewNotionSource(client *http.Client, cfg config.NotionConfig) NotionSource {
+	return NotionSource{client: client, cfg: cfg}
+}
+
+// Events fetches and parses the events of the day from the Notion database.
+func (s NotionSource) Events(ctx context.Context, day time.Time) ([]RawEvent, error) {
+	queryResponse, err := FetchCalendarData(ctx, s.client, s.cfg, day)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRawEvents(queryResponse, s.cfg)
+}
+
+// CollectEvents gathers the events of the day from every source.
+// A failing source is logged and skipped, unless every source fails.
+func CollectEvents(ctx context.Context, sources []CalendarSource, day time.Time) ([]RawEvent, error) {
+	rawEvents := []RawEvent{}
+	var errs []error
+	for _, source := range sources {
+		events, err := source.Events(ctx, day)
+		if err != nil {
+			log.Printf("Skipping the events of %T: %v", source, err)
+			errs = append(errs, err)
+			continue
+		}
+		rawEvents = append(rawEvents, events...)
+	}
+	if len(sources) > 0 && len(errs) == len(sources) {
+		return nil, errors.Join(errs...)
+	}
+	return rawEvents, nil
+}
+
 // FetchCalendarData fetches calendar data from the Notion API.
-func FetchCalendarData(ofWhen time.Time) (RawQueryResponse, error) {
+func FetchCalendarData(ctx context.Context, client *http.Client, cfg config.NotionConfig, ofWhen time.Time) (RawQueryResponse, error) {
 	var result RawQueryResponse
 	var err error
+	var req *http.Request
 	var resp *http.Response
-	var body []byte
-	var client *http.Client
+	var data, body []byte
 
 	// Calculate yesterday and tomorrow
 	tomorrow := ofWhen.AddDate(0, 0, 1)
@@ -229,54 +278,48 @@ func FetchCalendarData(ofWhen time.Time) (RawQueryResponse, error) {
 	todayIso := startOfToday.Format(time.RFC3339) // RFC3339 is a profile of ISO 8601
 	tomorrowIso := startOfTomorrow.Format(time.RFC3339)
 
-	endsOnOrAfterTodayFilter := fmt.Sprintf(`{
-			"property": "%s",
-			"date": {
-				"on_or_after": "%s"
-			}
-		}`, util.DATE_PROPERTYNAME, todayIso)
+	filters := []map[string]interface{}{
+		{
+			"property": cfg.DateProperty,
+			"date":     map[string]string{"on_or_after": todayIso},
+		},
+		{
+			"property": cfg.DateProperty,
+			"date":     map[string]string{"before": tomorrowIso},
+		},
+	}
 
-	startsBeforeTomorrowFilter := fmt.Sprintf(`{
-			"property": "%s",
-			"date": {
-				"before": "%s"
-			}
-		}`, util.DATE_PROPERTYNAME, tomorrowIso)
+	// Only the events of the configured category, if any, are shown
+	if cfg.CategoryProperty != "" {
+		filters = append(filters, map[string]interface{}{
+			"property": cfg.CategoryProperty,
+			"select":   map[string]string{"equals": cfg.CategoryValue},
+		})
+	}
 
-	categoryFilter := `{
-			"property": "カテゴリ",
-			"select": {
-				"equals": "EV"
-			}
-		}`
-
-	// Compile a regex to match tabs and new lines
-	regex := regexp.MustCompile(`[\t\n]+`) // Matches one or more tabs or newlines
-	data := regex.ReplaceAllString(fmt.Sprintf(`{
-			"filter": {
-				"and": [
-					%s,
-					%s,
-					%s
-				]
-			}
-		}`, endsOnOrAfterTodayFilter, startsBeforeTomorrowFilter, categoryFilter), "")
+	// Marshal the query of the events of the day
+	url := fmt.Sprintf("https://api.notion.com/v1/databases/%v/query", cfg.DatabaseID)
+	data, err = json.Marshal(map[string]interface{}{
+		"filter": map[string]interface{}{"and": filters},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to marshal notion calendar filter: %v", err)
+		goto notion_fetchcalendardata_finish
+	}
 
 	// Create a new request
-	url := fmt.Sprintf("https://api.notion.com/v1/databases/%v/query", util.DATABASE_ID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(data)))
+	req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
 	if err != nil {
 		err = fmt.Errorf("failed to create a request for notion calendar data: %v", err)
 		goto notion_fetchcalendardata_finish
 	}
 
 	// Set Headers
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", util.API_KEY))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", cfg.APIKey))
 	req.Header.Set("Notion-Version", "2022-06-28")
 	req.Header.Set("Content-Type", "application/json")
 
-	// Create an HTTP client and send the request
-	client = &http.Client{}
+	// Send the request with the shared HTTP client
 	resp, err = client.Do(req)
 	if err != nil {
 		err = fmt.Errorf("failed to fetch notion calendar data: %v", err)
@@ -301,47 +344,44 @@ notion_fetchcalendardata_finish:
 	return result, err
 }
 
-// ParseCalendarData parses the raw query response from Notion API into structured calendar data.
-func ParseCalendarData(queryResponse RawQueryResponse, forceAllDay bool) (CalendarData, error) {
+// ParseRawEvents parses the raw query response from Notion API into raw events.
+func ParseRawEvents(queryResponse RawQueryResponse, cfg config.NotionConfig) ([]RawEvent, error) {
 	var err error
-	var calendarData CalendarData
-	var minHours, maxHours, nSlot int
 	rawEvents := []RawEvent{}
-	events := []Event{}
 
 	if queryResponse.Object == "error" {
 		err = fmt.Errorf("error found in the calendar json data: %s", queryResponse.Message)
-		goto notion_parsecalendardata_finish
+		goto notion_parserawevents_finish
 	}
 	for _, res := range queryResponse.Results {
-		eventNameProp, exists := res.Properties[util.NAME_PROPERTYNAME]
+		eventNameProp, exists := res.Properties[cfg.NameProperty]
 		if !exists {
-			err = fmt.Errorf("error found no property corresponding to %s [properties/%s]: %v", util.NAME_PROPERTYNAME, util.NAME_PROPERTYNAME, res)
-			goto notion_parsecalendardata_finish
+			err = fmt.Errorf("error found no property corresponding to %s [properties/%s]: %v", cfg.NameProperty, cfg.NameProperty, res)
+			goto notion_parserawevents_finish
 		}
 
 		if eventNameProp.Title == nil || len(eventNameProp.Title) < 1 {
-			err = fmt.Errorf("error title is absent [properties/%s/title]: %v", util.NAME_PROPERTYNAME, res)
-			goto notion_parsecalendardata_finish
+			err = fmt.Errorf("error title is absent [properties/%s/title]: %v", cfg.NameProperty, res)
+			goto notion_parserawevents_finish
 		}
 
 		if eventNameProp.Title[0].Text == nil {
-			err = fmt.Errorf("error this is not a text object [properties/%s/title[0]]: %v", util.NAME_PROPERTYNAME, res)
-			goto notion_parsecalendardata_finish
+			err = fmt.Errorf("error this is not a text object [properties/%s/title[0]]: %v", cfg.NameProperty, res)
+			goto notion_parserawevents_finish
 		}
 
 		eventName := eventNameProp.Title[0].Text.Content
 
-		// event's date -> properties[util.DATE_PROPERTYNAME]["date"]
-		eventDateProp, exists := res.Properties[util.DATE_PROPERTYNAME]
+		// event's date -> properties[cfg.DateProperty]["date"]
+		eventDateProp, exists := res.Properties[cfg.DateProperty]
 		if !exists {
-			err = fmt.Errorf("error found no property corresponding to %s [properties/%s]: %v", util.DATE_PROPERTYNAME, util.DATE_PROPERTYNAME, res)
-			goto notion_parsecalendardata_finish
+			err = fmt.Errorf("error found no property corresponding to %s [properties/%s]: %v", cfg.DateProperty, cfg.DateProperty, res)
+			goto notion_parserawevents_finish
 		}
 
 		if eventDateProp.Date == nil {
-			err = fmt.Errorf("error title is absent [properties/%s/date]: %v", util.DATE_PROPERTYNAME, res)
-			goto notion_parsecalendardata_finish
+			err = fmt.Errorf("error title is absent [properties/%s/date]: %v", cfg.DateProperty, res)
+			goto notion_parserawevents_finish
 		}
 
 		eventDate := eventDateProp.Date
@@ -354,16 +394,16 @@ func ParseCalendarData(queryResponse RawQueryResponse, forceAllDay bool) (Calend
 		}
 		eventStartDate, err = time.Parse(layout, eventDate.Start)
 		if err != nil {
-			err = fmt.Errorf("error in converting string date to time [properties/%s/date/start]: %s", util.DATE_PROPERTYNAME, eventDate.Start)
-			goto notion_parsecalendardata_finish
+			err = fmt.Errorf("error in converting string date to time [properties/%s/date/start]: %s", cfg.DateProperty, eventDate.Start)
+			goto notion_parserawevents_finish
 		}
 		eventEndDate = eventStartDate
 		if eventDate.End != "" {
 			// end specified
 			eventEndDate, err = time.Parse(layout, eventDate.End)
 			if err != nil {
-				err = fmt.Errorf("error in converting string date to time [properties/%s/date/end]: %s", util.DATE_PROPERTYNAME, eventDate.End)
-				goto notion_parsecalendardata_finish
+				err = fmt.Errorf("error in converting string date to time [properties/%s/date/end]: %s", cfg.DateProperty, eventDate.End)
+				goto notion_parserawevents_finish
 			}
 		}
 		if !strings.Contains(eventDate.Start, ":") {
@@ -378,6 +418,16 @@ func ParseCalendarData(queryResponse RawQueryResponse, forceAllDay bool) (Calend
 		})
 	}
 
+notion_parserawevents_finish:
+	return rawEvents, err
+}
+
+// ParseCalendarData lays out the raw events of a day, from Notion and any other calendar source, for display.
+// Without forceAllDay, the hours span the timed events; a day with all-day events only has no slots.
+func ParseCalendarData(rawEvents []RawEvent, forceAllDay bool) CalendarData {
+	var minHours, maxHours, nSlot int
+	events := []Event{}
+
 	HierarchizeEvents(&rawEvents)
 
 	if forceAllDay {
@@ -393,14 +443,18 @@ func ParseCalendarData(queryResponse RawQueryResponse, forceAllDay bool) (Calend
 			}
 		}
 		if maxHours <= minHours {
-			fmt.Printf("maxHours is less than or equal to minHours. maybe no event is registered: %v, (%d, %d)\n", rawEvents, minHours, maxHours)
-			calendarData.Events = []Event{}
-			goto notion_parsecalendardata_finish
+			minHours = 0
+			maxHours = 0
 		}
 	}
-	nSlot = maxHours - minHours + 1
+	if maxHours > minHours {
+		nSlot = maxHours - minHours + 1
+	}
 
 	for _, event := range rawEvents {
+		if nSlot == 0 && !event.IsAllDay {
+			continue
+		}
 		events = append(events, Event{
 			Name:      event.Name,
 			TimeDesc:  fmt.Sprintf("%d:%02d-%d:%02d", event.Start.Hour(), event.Start.Minute(), event.End.Hour(), event.End.Minute()),
@@ -408,16 +462,14 @@ func ParseCalendarData(queryResponse RawQueryResponse, forceAllDay bool) (Calend
 			EndMins:   event.End.Hour()*60 + event.End.Minute(),
 			Level:     event.Level,
 			IsAllDay:  event.IsAllDay,
+			IsHoliday: event.IsHoliday,
 			Color:     "red",
 		})
 	}
-	calendarData = CalendarData{
+	return CalendarData{
 		MaxHours: maxHours,
 		MinHours: minHours,
 		NSlot:    nSlot,
 		Events:   events,
 	}
-
-notion_parsecalendardata_finish:
-	return calendarData, err
 }
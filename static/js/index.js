@@ -1,7 +1,7 @@
 import { argbFromHex, themeFromSourceColor, applyTheme } from "/static/packages/@material/material-color-utilities/index.js";
 
-// Get the theme from a hex color
-const theme = themeFromSourceColor(argbFromHex('#f82506'), [
+// Get the theme from the hex seed color of the configuration
+const theme = themeFromSourceColor(argbFromHex(document.body.dataset.themeSeedColor || '#f82506'), [
   {
     name: "custom-1",
     value: argbFromHex("#ff0000"),
@@ -9,24 +9,214 @@ const theme = themeFromSourceColor(argbFromHex('#f82506'), [
   },
 ]);
 
-// Check if the user has dark mode turned on
-const systemDark = window.matchMedia("(prefers-color-scheme: dark)").matches;
-
 // Apply the theme to the body by updating custom properties for material tokens
-applyTheme(theme, {target: document.body, dark: systemDark});
+export function setDarkMode(dark) {
+  applyTheme(theme, {target: document.body, dark: dark});
+}
+
+// Follow the system setting until the sun position at the layout location is known
+setDarkMode(window.matchMedia("(prefers-color-scheme: dark)").matches);
+
+// Switch to the dark theme between sunset and sunrise at the given location
+export function startAutoDarkMode(latitude, longitude) {
+  function update() {
+    fetch(`/api/sky/theme?location_latitude=${latitude}&location_longitude=${longitude}`)
+        .then(response => response.json())
+        .then(data => {
+            setDarkMode(data.dark);
+            // Check again right after the next sunrise or sunset, and at least every hour
+            setTimeout(update, Math.min(Math.max(data.next_change_in + 5, 60), 60 * 60) * 1000);
+        })
+        .catch(error => {
+            console.error('Error:', error);
+            setTimeout(update, 5 * 60 * 1000);
+        });
+  }
+  update();
+}
+
+
+// Offset of the server clock from the browser clock, in milliseconds
+let clockOffset = 0;
+
+const TIME_SYNC_SAMPLES = 4;
+const TIME_SYNC_INTERVAL = 10 * 60 * 1000;
+
+// Returns the current time of the server, correcting the drift of the browser clock
+export function serverNow() {
+  return new Date(Date.now() + clockOffset);
+}
+
+// Measures the clock offset and round-trip delay with one request, as in NTP
+function sampleClockOffset() {
+  const originate = Date.now();
+  return fetch(`/api/time?originate=${originate}`, { cache: 'no-store' })
+      .then(response => response.json())
+      .then(data => {
+          const destination = Date.now();
+          return {
+              offset: ((data.receive - data.originate) + (data.transmit - destination)) / 2,
+              delay: (destination - data.originate) - (data.transmit - data.receive),
+          };
+      });
+}
+
+// Keeps the offset of the sample with the shortest round trip, the least skewed by network delays
+export async function syncClock() {
+  let best = null;
+  for (let i = 0; i < TIME_SYNC_SAMPLES; i++) {
+    try {
+      const sample = await sampleClockOffset();
+      if (best === null || sample.delay < best.delay) {
+        best = sample;
+      }
+    } catch (error) {
+      console.error('Error:', error);
+    }
+  }
+  if (best !== null) {
+    clockOffset = best.offset;
+  }
+}
+
+syncClock();
+setInterval(syncClock, TIME_SYNC_INTERVAL);
+
+// Moves the now-line of a timeline every minute, hiding it outside the hours of the timeline
+export function startNowLineUpdater(linesId) {
+  setInterval(() => {
+    let nowLineElement = document.querySelector(`#${linesId}>.nowline`);
+    if (nowLineElement !== null) {
+      let a = serverNow();
+      let mins = a.getHours() * 60 + a.getMinutes();
+      let visible = mins >= nowLineElement.dataset.minHours * 60 && mins <= nowLineElement.dataset.maxHours * 60;
+      if (visible) {
+        nowLineElement.style.setProperty("--now-minutes", mins);
+      }
+      nowLineElement.style.setProperty("--nowline-visibility", visible ? "visible" : "hidden");
+    }
+  }, 1000 * 60);
+}
+
+// Alerts currently raised by widgets, keyed by widget ID
+const alerts = new Map();
+
+// Render the layout-wide alert banner from the raised alerts
+function renderAlertBanner() {
+  const banner = document.getElementById("alert-banner");
+  if (banner === null) {
+    return;
+  }
+  banner.innerText = Array.from(alerts.values()).join("  /  ");
+  banner.classList.toggle("visible", alerts.size > 0);
+}
+
+export function raiseAlert(key, message) {
+  alerts.set(key, message);
+  renderAlertBanner();
+}
+
+export function clearAlert(key) {
+  alerts.delete(key);
+  renderAlertBanner();
+}
+
+// Overlays currently raised by widgets, keyed by widget ID, and the IDs dismissed by a click
+const overlays = new Map();
+const dismissedOverlays = new Set();
+
+// Render the full-screen overlay from the first raised overlay not dismissed yet
+function renderOverlay() {
+  const element = document.getElementById("overlay");
+  if (element === null) {
+    return;
+  }
+  const overlay = Array.from(overlays.values()).find(o => !dismissedOverlays.has(o.id));
+  if (overlay !== undefined) {
+    document.getElementById("overlay-title").innerText = overlay.title;
+    document.getElementById("overlay-message").innerText = overlay.message;
+    element.onclick = () => {
+      dismissedOverlays.add(overlay.id);
+      renderOverlay();
+    };
+  }
+  element.classList.toggle("visible", overlay !== undefined);
+}
+
+export function raiseOverlay(key, overlay) {
+  overlays.set(key, overlay);
+  renderOverlay();
+}
+
+export function clearOverlay(key) {
+  overlays.delete(key);
+  renderOverlay();
+}
+
+// Show an error card over the widget, with a button retrying the update
+function showWidgetError(widgetId, message, retry) {
+  const widget = document.querySelector(`[data-widget-id="${widgetId}"]`);
+  if (widget === null) {
+    return;
+  }
+  let card = document.getElementById(`wgerror-${widgetId}`);
+  if (card === null) {
+    card = document.createElement("div");
+    card.className = "widget-error";
+    card.id = `wgerror-${widgetId}`;
+    const title = document.createElement("span");
+    title.className = "widget-error-title";
+    title.innerText = "Widget unavailable";
+    const text = document.createElement("span");
+    text.className = "widget-error-message";
+    const button = document.createElement("button");
+    button.className = "widget-error-retry";
+    button.innerText = "Retry";
+    card.append(title, text, button);
+    widget.appendChild(card);
+  }
+  card.querySelector(".widget-error-message").innerText = message;
+  card.querySelector(".widget-error-retry").onclick = retry;
+}
 
+function clearWidgetError(widgetId) {
+  document.getElementById(`wgerror-${widgetId}`)?.remove();
+}
 
 export function updateData(widgetId, widgetType, queryString) {
+  const retry = () => updateData(widgetId, widgetType, queryString);
   fetch(`/api/${widgetType}?${queryString}`)
-      .then(response => response.json())
+      .then(response => response.json().then(data => {
+          // Handlers report failures as an "error" field with an error status
+          if (!response.ok || data.error) {
+              throw new Error(data.error || `${response.status} ${response.statusText}`);
+          }
+          return data;
+      }))
       .then(data => {
+          clearWidgetError(widgetId);
+
+          // Widgets raise a layout-wide alert by returning a non-empty "alert" field
+          if (data.alert) {
+              raiseAlert(widgetId, data.alert);
+          } else {
+              clearAlert(widgetId);
+          }
+
+          // Widgets raise a full-screen overlay by returning an "overlay" object with an ID, a title and a message
+          if (data.overlay) {
+              raiseOverlay(widgetId, data.overlay);
+          } else {
+              clearOverlay(widgetId);
+          }
+
           // Function to convert kebab-case string to snake_case
           function toSnakeCase(str) {
               return str.replace(/([a-z])([A-Z])/g, '$1_$2').toLowerCase();
           }
 
           // Select all elements whose ID starts with "wgcontent-{widgetId}"
-          var elements = document.querySelectorAll(`[id^="wgcontent-${widgetId}"]`);
+          var elements = document.querySelectorAll(`[id^="wgcontent-${widgetId}-"]`);
 
           elements.forEach(function (element) {
               var elementId = element.id;
@@ -54,7 +244,275 @@ export function updateData(widgetId, widgetType, queryString) {
               }
           });
       })
-      .catch(error => console.error('Error:', error));
+      .catch(error => {
+          console.error('Error:', error);
+          showWidgetError(widgetId, error.message, retry);
+      });
+}
+
+// Timers of the widgets updating from the API, keyed by widget ID
+const widgetTimers = new Map();
+
+// Start updating a widget from the API, as described by its data attributes.
+// A stack starts rotating its widgets, which update on their own.
+export function startWidget(widget) {
+  const { widgetId, widgetType, widgetQuery, refreshInterval } = widget.dataset;
+  clearInterval(widgetTimers.get(widgetId));
+  widgetTimers.delete(widgetId);
+  if (widgetType === "stack") {
+    startStack(widget);
+  }
+  if (widgetQuery === undefined) {
+    return;
+  }
+  const update = () => updateData(widgetId, widgetType, widgetQuery);
+  widget.querySelector('.update-btn')?.addEventListener('click', update);
+  update();
+  if (Number(refreshInterval) > 0) {
+    widgetTimers.set(widgetId, setInterval(update, Number(refreshInterval) * 1000));
+  }
+}
+
+export function startWidgets(root) {
+  root.querySelectorAll('[data-widget-id]').forEach(startWidget);
+}
+
+// Horizontal distance in pixels a touch must travel to change pages or the widgets of a stack
+const SWIPE_THRESHOLD = 50;
+
+// Timers rotating the stacks, keyed by widget ID
+const stackTimers = new Map();
+
+// Rotate the widgets of a stack on its interval. Swiping over the stack shows the next or the previous widget
+// instead of changing the page of the carousel.
+function startStack(widget) {
+  const stack = widget.querySelector('.stack');
+  const items = Array.from(stack?.querySelectorAll(':scope > .stack-item') ?? []);
+  clearInterval(stackTimers.get(widget.dataset.widgetId));
+  stackTimers.delete(widget.dataset.widgetId);
+  if (items.length < 2) {
+    return;
+  }
+  let current = Math.max(items.findIndex(item => item.classList.contains("active")), 0);
+  const restart = () => {
+    clearInterval(stackTimers.get(widget.dataset.widgetId));
+    stackTimers.set(widget.dataset.widgetId, setInterval(() => show(current + 1), Number(stack.dataset.stackInterval) * 1000));
+  };
+  const show = index => {
+    items[current].classList.remove("active");
+    current = (index + items.length) % items.length;
+    items[current].classList.add("active");
+  };
+  restart();
+
+  let touchStart = null;
+  stack.addEventListener("touchstart", event => {
+    touchStart = event.touches.length === 1 ? { x: event.touches[0].clientX, y: event.touches[0].clientY } : null;
+  }, { passive: true });
+  stack.addEventListener("touchend", event => {
+    if (touchStart === null) {
+      return;
+    }
+    const dx = event.changedTouches[0].clientX - touchStart.x;
+    const dy = event.changedTouches[0].clientY - touchStart.y;
+    touchStart = null;
+    if (Math.abs(dx) >= SWIPE_THRESHOLD && Math.abs(dx) > Math.abs(dy)) {
+      event.stopPropagation();
+      show(dx < 0 ? current + 1 : current - 1);
+      restart();
+    }
+  });
+}
+
+// How long before its turn the widgets of the next page start fetching their data
+const PAGE_PREFETCH_LEAD = 5 * 1000;
+
+// Rotate the pages of the carousel, each shown for its dwell time.
+// The widgets of a page start updating shortly before it shows, and keep updating afterwards.
+// Swiping left or right shows the next or the previous page and restarts the dwell time.
+export function startCarousel(carousel) {
+  const pages = Array.from(carousel.querySelectorAll('.carousel-page'));
+  const started = new Set();
+  const prefetch = page => {
+    if (!started.has(page)) {
+      started.add(page);
+      startWidgets(page);
+    }
+  };
+  let current = 0;
+  let prefetchTimer = null;
+  let showTimer = null;
+
+  const schedule = () => {
+    clearTimeout(prefetchTimer);
+    clearTimeout(showTimer);
+    const dwell = Number(pages[current].dataset.dwell) * 1000;
+    const next = pages[(current + 1) % pages.length];
+    prefetchTimer = setTimeout(() => prefetch(next), Math.max(dwell - PAGE_PREFETCH_LEAD, 0));
+    showTimer = setTimeout(() => show(current + 1, true), dwell);
+  };
+
+  const show = (index, forward) => {
+    index = (index + pages.length) % pages.length;
+    if (index === current) {
+      return;
+    }
+    const leaving = pages[current];
+    const entering = pages[index];
+    prefetch(entering);
+    // Place the entering page on the side it comes from before animating it in
+    entering.classList.add("placing");
+    entering.classList.toggle("before", !forward);
+    entering.getBoundingClientRect();
+    entering.classList.remove("placing", "before");
+    leaving.classList.remove("active");
+    leaving.classList.toggle("before", forward);
+    entering.classList.add("active");
+    current = index;
+    schedule();
+  };
+
+  prefetch(pages[current]);
+  if (pages.length < 2) {
+    return;
+  }
+  schedule();
+
+  let touchStart = null;
+  carousel.addEventListener("touchstart", event => {
+    touchStart = event.touches.length === 1 ? { x: event.touches[0].clientX, y: event.touches[0].clientY } : null;
+  }, { passive: true });
+  carousel.addEventListener("touchend", event => {
+    if (touchStart === null) {
+      return;
+    }
+    const dx = event.changedTouches[0].clientX - touchStart.x;
+    const dy = event.changedTouches[0].clientY - touchStart.y;
+    touchStart = null;
+    if (Math.abs(dx) >= SWIPE_THRESHOLD && Math.abs(dx) > Math.abs(dy)) {
+      show(dx < 0 ? current + 1 : current - 1, dx < 0);
+    }
+  });
+}
+
+// Swap the widgets changed on the server for their new version.
+// Widgets running scripts of their own cannot be swapped without leaking their timers, so the page is reloaded instead.
+async function reloadWidgets(widgetIds, widgetTypes) {
+  const widgets = Array.from(document.querySelectorAll('[data-widget-id]'))
+    .filter(widget => widgetIds.includes(widget.dataset.widgetId) || widgetTypes.includes(widget.dataset.widgetType));
+  if (widgets.length === 0) {
+    return;
+  }
+  const response = await fetch(location.href, { cache: "no-store" });
+  if (!response.ok) {
+    location.reload();
+    return;
+  }
+  const page = new DOMParser().parseFromString(await response.text(), "text/html");
+  for (const widget of widgets) {
+    // The widgets of a stack are swapped with the stack
+    if (!widget.isConnected) {
+      continue;
+    }
+    const fresh = page.querySelector(`[data-widget-id="${widget.dataset.widgetId}"]`);
+    if (fresh === null || widget.querySelector('script') !== null || fresh.querySelector('script') !== null) {
+      location.reload();
+      return;
+    }
+    widget.replaceWith(document.adoptNode(fresh));
+    clearAlert(widget.dataset.widgetId);
+    clearOverlay(widget.dataset.widgetId);
+    startWidget(fresh);
+    startWidgets(fresh);
+  }
+}
+
+// Reload the page in the orientation of the screen whenever it turns, for the layouts with a portrait grid
+export function followOrientation(orientation) {
+  const portrait = window.matchMedia("(orientation: portrait)");
+  const check = () => {
+    const wanted = portrait.matches ? "portrait" : "landscape";
+    if (wanted !== orientation) {
+      const url = new URL(location.href);
+      url.searchParams.set("orientation", wanted);
+      location.replace(url);
+    }
+  };
+  portrait.addEventListener("change", check);
+  check();
+}
+
+// Apply a command sent to this display through the admin API
+function applyCommand(command) {
+  switch (command.action) {
+    case "layout":
+      location.replace(`/?layout=${encodeURIComponent(command.layout)}`);
+      break;
+    case "reload":
+      location.reload();
+      break;
+    case "message": {
+      const key = `command:${Date.now()}`;
+      raiseOverlay(key, { id: key, title: command.title ?? "", message: command.message });
+      if (command.duration > 0) {
+        setTimeout(() => clearOverlay(key), command.duration * 1000);
+      }
+      break;
+    }
+    case "dim":
+      document.body.style.filter = command.brightness < 1 ? `brightness(${command.brightness})` : "";
+      break;
+    case "blank":
+      document.getElementById("screen-blank")?.classList.toggle("visible", command.blank);
+      break;
+  }
+}
+
+// Register this display on the push channel, then follow its commands and the edits of the layouts and templates.
+// The whole page is reloaded when the grid changes or when the server restarts.
+export function connectPushChannel(layoutName) {
+  const query = new URLSearchParams({
+    layout: layoutName,
+    width: String(window.innerWidth),
+    height: String(window.innerHeight),
+  });
+  const events = new EventSource(`/api/events?${query}`);
+  let disconnected = false;
+  events.onerror = () => {
+    disconnected = true;
+  };
+  events.onopen = () => {
+    if (disconnected) {
+      location.reload();
+    }
+  };
+  events.addEventListener("reload", event => {
+    const reload = JSON.parse(event.data);
+    if (reload.layout !== "" && reload.layout !== layoutName) {
+      return;
+    }
+    if (reload.full) {
+      location.reload();
+      return;
+    }
+    reloadWidgets(reload.widget_ids, reload.widget_types).catch(error => {
+      console.error('Error:', error);
+      location.reload();
+    });
+  });
+  events.addEventListener("command", event => applyCommand(JSON.parse(event.data)));
+  // Validation errors of the templates and of this layout are shown on the alert banner until fixed
+  events.addEventListener("reloaderror", event => {
+    const failure = JSON.parse(event.data);
+    if (failure.file !== "templates" && failure.file !== `${layoutName}.json`) {
+      return;
+    }
+    if (failure.message) {
+      raiseAlert(`reload:${failure.file}`, failure.message);
+    } else {
+      clearAlert(`reload:${failure.file}`);
+    }
+  });
 }
 
 export function formatJapaneseDate(date, lang) {
@@ -90,10 +548,45 @@ export function formatJapaneseDate(date, lang) {
   return `${year}(${currentEra.name} ${eraYear})/${month}/${day} ${dayOfWeek}`;
 }
 
-export function formatTime(date) {
-  const hours = String(date.getHours()).padStart(2, '0');
+export function formatTime(date, options = {}) {
+  const hour12 = options.hour12 ?? false;
+  const showSeconds = options.seconds ?? true;
+
+  let hours = date.getHours();
+  let prefix = '';
+  let suffix = '';
+  if (hour12) {
+    const pm = hours >= 12;
+    hours = hours % 12 === 0 ? 12 : hours % 12;
+    if (options.language === 'JP') {
+      prefix = pm ? '午後' : '午前';
+    } else {
+      suffix = pm ? ' PM' : ' AM';
+    }
+  }
+
+  const hoursStr = hour12 ? String(hours) : String(hours).padStart(2, '0');
   const minutes = String(date.getMinutes()).padStart(2, '0');
   const seconds = String(date.getSeconds()).padStart(2, '0');
 
-  return `${hours}:${minutes}:${seconds}`;
-}
\ No newline at end of file
+  return `${prefix}${hoursStr}:${minutes}${showSeconds ? `:${seconds}` : ''}${suffix}`;
+}
+
+// Returns a Date whose local fields are the wall time of the date in the time zone (the browser's when empty)
+export function zonedDate(date, timeZone) {
+  if (!timeZone) {
+    return date;
+  }
+  return new Date(date.toLocaleString('en-US', { timeZone: timeZone }));
+}
+
+// Formats the UTC offset of the time zone at the date, e.g. "UTC+9" or "UTC+5:30"
+export function formatUtcOffset(date, timeZone) {
+  const utc = new Date(date.toLocaleString('en-US', { timeZone: 'UTC' }));
+  const offset = Math.round((zonedDate(date, timeZone) - utc) / 60000);
+  const sign = offset < 0 ? '-' : '+';
+  const hours = Math.floor(Math.abs(offset) / 60);
+  const minutes = Math.abs(offset) % 60;
+
+  return `UTC${sign}${hours}${minutes ? `:${String(minutes).padStart(2, '0')}` : ''}`;
+}
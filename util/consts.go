@@ -4,6 +4,9 @@ package util
 // API_ROOT_PATH is the base path for all API endpoints.
 const API_ROOT_PATH = "/api/"
 
+// MISSING_VALUE is displayed in place of a forecast value the model does not provide.
+const MISSING_VALUE = "--"
+
 // TEMP_FORMAT_CUR is the format string for displaying current temperature.
 const TEMP_FORMAT_CUR = "%.1f°"
 
@@ -13,8 +16,29 @@ const TEMP_FORMAT_HOUR = "%.1f°"
 // TEMP_FORMAT_DAY is the format string for displaying daily temperature.
 const TEMP_FORMAT_DAY = "%.0f°"
 
-// NAME_PROPERTYNAME is the property name used for event names in the Notion API.
-const NAME_PROPERTYNAME = "名前"
+// TEMP_FORMAT_ERR is the format string for displaying temperature errors.
+const TEMP_FORMAT_ERR = "±%.1f°"
+
+// HUMIDITY_FORMAT is the format string for displaying relative humidity.
+const HUMIDITY_FORMAT = "%.0f%%"
+
+// PRECIPITATION_FORMAT is the format string for displaying precipitation amounts.
+const PRECIPITATION_FORMAT = "%.1f mm"
+
+// PROBABILITY_FORMAT is the format string for displaying precipitation probabilities.
+const PROBABILITY_FORMAT = "%.0f%%"
+
+// WIND_FORMAT is the format string for displaying wind speeds.
+const WIND_FORMAT = "%.1f m/s"
+
+// UV_FORMAT is the format string for displaying UV indices.
+const UV_FORMAT = "%.0f"
+
+// AQI_FORMAT is the format string for displaying air quality indices.
+const AQI_FORMAT = "%.0f"
+
+// CONCENTRATION_FORMAT is the format string for displaying pollutant concentrations.
+const CONCENTRATION_FORMAT = "%.0f µg/m³"
 
-// DATE_PROPERTYNAME is the property name used for event dates in the Notion API.
-const DATE_PROPERTYNAME = "日付"
+// POLLEN_FORMAT is the format string for displaying pollen counts.
+const POLLEN_FORMAT = "%.0f grains/m³"
@@ -0,0 +1,29 @@
+// Package util provides utility functions for various operations.
+package util
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTP_TIMEOUT is the overall timeout of a single outgoing request.
+const HTTP_TIMEOUT = 15 * time.Second
+
+// NewHTTPClient creates the HTTP client shared by the data fetchers.
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: HTTP_TIMEOUT,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost:   8,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
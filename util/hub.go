@@ -0,0 +1,60 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// HUB_BUFFER_SIZE is the number of messages a subscriber can fall behind before messages are dropped for it.
+const HUB_BUFFER_SIZE = 16
+
+// EVENTS_KEEPALIVE_INTERVAL is how often the push channel sends a ping, keeping idle connections open through proxies.
+const EVENTS_KEEPALIVE_INTERVAL = 30 * time.Second
+
+// Message represents a named event pushed to the subscribers of a Hub.
+type Message struct {
+	Event string
+	Data  interface{}
+}
+
+// Hub broadcasts messages to every subscriber, such as the displays connected to the push channel.
+type Hub struct {
+	mutex       sync.Mutex
+	subscribers map[chan Message]struct{}
+}
+
+// NewHub creates a Hub without subscribers.
+func NewHub() *Hub {
+	return &Hub{subscribers: map[chan Message]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the messages published from now on.
+func (h *Hub) Subscribe() chan Message {
+	ch := make(chan Message, HUB_BUFFER_SIZE)
+	h.mutex.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mutex.Unlock()
+	return ch
+}
+
+// Unsubscribe stops and closes the channel returned by Subscribe.
+func (h *Hub) Unsubscribe(ch chan Message) {
+	h.mutex.Lock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+	h.mutex.Unlock()
+}
+
+// Publish sends the message to every subscriber without blocking; a subscriber whose buffer is full misses it.
+func (h *Hub) Publish(event string, data interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- Message{Event: event, Data: data}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// OverlayFS is a file system reading the files of an on-disk directory first
+// and falling back to the embedded files, so that the embedded defaults can be overridden file by file.
+type OverlayFS struct {
+	disk     fs.FS
+	embedded fs.FS
+}
+
+// NewOverlayFS creates an OverlayFS over the directory dir and the embedded files.
+// An empty or missing directory serves the embedded files only.
+func NewOverlayFS(dir string, embedded fs.FS) OverlayFS {
+	overlay := OverlayFS{embedded: embedded}
+	if info, err := os.Stat(dir); dir != "" && err == nil && info.IsDir() {
+		overlay.disk = os.DirFS(dir)
+	}
+	return overlay
+}
+
+// Open opens the named file from the directory, or from the embedded files when the directory does not have it.
+func (o OverlayFS) Open(name string) (fs.File, error) {
+	if o.disk != nil {
+		file, err := o.disk.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+	}
+	return o.embedded.Open(name)
+}
+
+// ReadDir lists the entries of both the directory and the embedded files, the directory taking precedence.
+func (o OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, embeddedErr := fs.ReadDir(o.embedded, name)
+	if o.disk == nil {
+		return entries, embeddedErr
+	}
+	diskEntries, diskErr := fs.ReadDir(o.disk, name)
+	if diskErr != nil {
+		if errors.Is(diskErr, fs.ErrNotExist) {
+			return entries, embeddedErr
+		}
+		return nil, diskErr
+	}
+	for _, entry := range entries {
+		if !slices.ContainsFunc(diskEntries, func(e fs.DirEntry) bool { return e.Name() == entry.Name() }) {
+			diskEntries = append(diskEntries, entry)
+		}
+	}
+	slices.SortFunc(diskEntries, func(a fs.DirEntry, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return diskEntries, nil
+}
+
+// Sub returns the overlay of the subdirectory dir of both file systems.
+func (o OverlayFS) Sub(dir string) (fs.FS, error) {
+	var err error
+	sub := OverlayFS{}
+	if sub.embedded, err = fs.Sub(o.embedded, dir); err != nil {
+		return nil, err
+	}
+	if o.disk != nil {
+		if sub.disk, err = fs.Sub(o.disk, dir); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
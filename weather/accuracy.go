@@ -0,0 +1,395 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+	"github.com/kken7231/screensaver/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OPEN_METEO_JMA is the provider name of the Open-Meteo JMA model forecasts.
+const OPEN_METEO_JMA = "open-meteo-jma"
+
+// FORECAST_SNAPSHOT_HOURS is the number of forecast hours kept in each snapshot.
+const FORECAST_SNAPSHOT_HOURS = 48
+
+// FORECAST_RETENTION is how long forecast snapshots are kept for scoring.
+const FORECAST_RETENTION = 30 * 24 * time.Hour
+
+// ForecastHour represents one forecast hour in a snapshot.
+type ForecastHour struct {
+	Time        time.Time `json:"time"`
+	Temp        float64   `json:"temp"`
+	WeatherCode int       `json:"weather_code"`
+}
+
+// ForecastSnapshot represents a forecast as it was fetched for one location.
+type ForecastSnapshot struct {
+	Provider     string         `json:"provider"`
+	LocationName string         `json:"location_name"`
+	AmedasCode   string         `json:"amedas_code"`
+	IssuedAt     time.Time      `json:"issued_at"`
+	Hours        []ForecastHour `json:"hours"`
+}
+
+// SnapshotForecast takes a snapshot of the forecast hours following issuedAt.
+func SnapshotForecast(data RawForecastData, provider, location_name, amedas_code string, issuedAt time.Time) (ForecastSnapshot, error) {
+	snapshot := ForecastSnapshot{
+		Provider:     provider,
+		LocationName: location_name,
+		AmedasCode:   amedas_code,
+		IssuedAt:     issuedAt,
+	}
+
+	location, err := time.LoadLocation(data.Timezone)
+	if err != nil {
+		return snapshot, fmt.Errorf("invalid time zone \"%s\"", data.Timezone)
+	}
+
+	for i, datetimeStr := range data.Hourly.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", datetimeStr, location)
+		if err != nil {
+			return snapshot, fmt.Errorf("invalid forecast time \"%s\"", datetimeStr)
+		}
+		if !t.After(issuedAt) || len(snapshot.Hours) >= FORECAST_SNAPSHOT_HOURS {
+			continue
+		}
+		snapshot.Hours = append(snapshot.Hours, ForecastHour{
+			Time:        t,
+			Temp:        data.Hourly.Temperature2M[i],
+			WeatherCode: data.Hourly.WeatherCode[i],
+		})
+	}
+	return snapshot, nil
+}
+
+// ForecastTracker stores forecast snapshots as one JSON file per AMeDAS station under its directory,
+// the station being the one the forecasts are scored against.
+type ForecastTracker struct {
+	dir       string
+	mu        sync.Mutex
+	snapshots map[string][]ForecastSnapshot
+}
+
+// NewForecastTracker creates a forecast tracker persisting its snapshots under dir.
+func NewForecastTracker(dir string) *ForecastTracker {
+	return &ForecastTracker{
+		dir:       dir,
+		snapshots: map[string][]ForecastSnapshot{},
+	}
+}
+
+// stationPath returns the file path holding the snapshots of the station.
+func (t *ForecastTracker) stationPath(amedas_code string) (string, error) {
+	if !ValidAmedasCode(amedas_code) {
+		return "", fmt.Errorf("invalid amedas location code \"%s\"", amedas_code)
+	}
+	return filepath.Join(t.dir, amedas_code+".json"), nil
+}
+
+// load returns the snapshots of the station. The caller must hold t.mu.
+// Only the stations stored on disk are cached, so that unknown stations do not grow the cache.
+func (t *ForecastTracker) load(amedas_code string) ([]ForecastSnapshot, error) {
+	path, err := t.stationPath(amedas_code)
+	if err != nil {
+		return nil, err
+	}
+	if snapshots, ok := t.snapshots[path]; ok {
+		return snapshots, nil
+	}
+
+	var snapshots []ForecastSnapshot
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return snapshots, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read forecast snapshots %s: %v", path, err)
+	}
+	if err = json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal forecast snapshots %s: %v", path, err)
+	}
+	t.snapshots[path] = snapshots
+	return snapshots, nil
+}
+
+// Record stores the snapshot, keeping at most one snapshot per provider and issue hour.
+// Snapshots older than FORECAST_RETENTION are dropped.
+func (t *ForecastTracker) Record(snapshot ForecastSnapshot) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	existing, err := t.load(snapshot.AmedasCode)
+	if err != nil {
+		return err
+	}
+
+	issuedHour := snapshot.IssuedAt.Truncate(time.Hour)
+	snapshots := slices.DeleteFunc(slices.Clone(existing), func(s ForecastSnapshot) bool {
+		sameHour := s.Provider == snapshot.Provider && s.IssuedAt.Truncate(time.Hour).Equal(issuedHour)
+		return sameHour || snapshot.IssuedAt.Sub(s.IssuedAt) > FORECAST_RETENTION
+	})
+	snapshots = append(snapshots, snapshot)
+
+	path, _ := t.stationPath(snapshot.AmedasCode)
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return fmt.Errorf("failed to marshal forecast snapshots %s: %v", path, err)
+	}
+	if err = os.MkdirAll(t.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create forecast directory: %v", err)
+	}
+	if err = os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write forecast snapshots %s: %v", path, err)
+	}
+	t.snapshots[path] = snapshots
+	return nil
+}
+
+// Snapshots returns the stored snapshots of the station.
+func (t *ForecastTracker) Snapshots(amedas_code string) ([]ForecastSnapshot, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshots, err := t.load(amedas_code)
+	return slices.Clone(snapshots), err
+}
+
+// Stations returns the AMeDAS codes of every station with stored snapshots.
+func (t *ForecastTracker) Stations() ([]string, error) {
+	var stations []string
+
+	paths, err := filepath.Glob(filepath.Join(t.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		amedas_code := strings.TrimSuffix(filepath.Base(path), ".json")
+		if !ValidAmedasCode(amedas_code) {
+			continue
+		}
+		stations = append(stations, amedas_code)
+	}
+	return stations, nil
+}
+
+// LeadTimeBucket groups forecast hours by how far ahead they were forecast.
+type LeadTimeBucket struct {
+	Label string
+	From  int
+	To    int
+}
+
+// Lead time buckets used for scoring, in hours ahead of the issue time.
+var leadTimeBuckets = []LeadTimeBucket{
+	{Label: "1-3h", From: 1, To: 3},
+	{Label: "4-6h", From: 4, To: 6},
+	{Label: "7-12h", From: 7, To: 12},
+	{Label: "13-24h", From: 13, To: 24},
+	{Label: "25-48h", From: 25, To: 48},
+}
+
+// LeadTimeScore represents the temperature error of the forecasts in one lead time bucket.
+type LeadTimeScore struct {
+	LeadTime string  `json:"lead_time"`
+	MAE      float64 `json:"mae"`
+	MAEDesc  string  `json:"mae_desc"`
+	Samples  int     `json:"samples"`
+}
+
+// RainScore represents the rain hit/miss contingency of the forecasts.
+type RainScore struct {
+	Samples          int     `json:"samples"`
+	Hits             int     `json:"hits"`
+	Misses           int     `json:"misses"`
+	FalseAlarms      int     `json:"false_alarms"`
+	CorrectNegatives int     `json:"correct_negatives"`
+	HitRate          float64 `json:"hit_rate"`
+	Accuracy         float64 `json:"accuracy"`
+}
+
+// AccuracyReport represents how trustworthy a provider has been for a location.
+type AccuracyReport struct {
+	Provider     string          `json:"provider"`
+	LocationName string          `json:"location_name"`
+	AmedasCode   string          `json:"amedas_code"`
+	Samples      int             `json:"samples"`
+	MAE          float64         `json:"mae"`
+	LeadTimes    []LeadTimeScore `json:"lead_times"`
+	Rain         RainScore       `json:"rain"`
+}
+
+// IsRainCode reports whether the weather code forecasts liquid precipitation.
+func IsRainCode(code WeatherCode) bool {
+	switch code {
+	case DrizzleLight, DrizzleModerate, DrizzleDense,
+		FreezingDrizzleLight, FreezingDrizzleDense,
+		RainSlight, RainModerate, RainHeavy,
+		FreezingRainLight, FreezingRainHeavy,
+		RainShowersSlight, RainShowersModerate, RainShowersViolent,
+		ThunderstormSlightOrModerate, ThunderstormWithSlightHail, ThunderstormWithHeavyHail:
+		return true
+	}
+	return false
+}
+
+// ScoreForecasts scores the stored snapshots of the station against its observations in the history store.
+// Only forecast hours that have passed before now are scored: the temperature when it was observed at that hour,
+// and the rain when precipitation was observed during the hour before.
+func ScoreForecasts(tracker *ForecastTracker, historyStore *HistoryStore, amedas_code string, now time.Time) ([]AccuracyReport, error) {
+	var reports []AccuracyReport
+
+	snapshots, err := tracker.Snapshots(amedas_code)
+	if err != nil {
+		return nil, err
+	}
+
+	byProvider := map[string][]ForecastSnapshot{}
+	var providers []string
+	for _, snapshot := range snapshots {
+		if _, ok := byProvider[snapshot.Provider]; !ok {
+			providers = append(providers, snapshot.Provider)
+		}
+		byProvider[snapshot.Provider] = append(byProvider[snapshot.Provider], snapshot)
+	}
+
+	for _, provider := range providers {
+		report := AccuracyReport{
+			Provider:   provider,
+			AmedasCode: amedas_code,
+		}
+		errSums := make([]float64, len(leadTimeBuckets))
+		errCounts := make([]int, len(leadTimeBuckets))
+		var errSum float64
+
+		for _, snapshot := range byProvider[provider] {
+			report.LocationName = snapshot.LocationName
+			if snapshot.AmedasCode == "" || len(snapshot.Hours) == 0 {
+				continue
+			}
+			observations, err := historyStore.Range(snapshot.AmedasCode, snapshot.IssuedAt.Add(-time.Hour), snapshot.Hours[len(snapshot.Hours)-1].Time.Add(time.Minute))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, hour := range snapshot.Hours {
+				if hour.Time.After(now) {
+					break
+				}
+				observed, tempObserved, rained, rainObserved := observedAt(observations, hour.Time)
+				if tempObserved {
+					leadHours := int(math.Ceil(hour.Time.Sub(snapshot.IssuedAt).Hours()))
+					absErr := math.Abs(hour.Temp - observed)
+					for i, bucket := range leadTimeBuckets {
+						if leadHours >= bucket.From && leadHours <= bucket.To {
+							errSums[i] += absErr
+							errCounts[i]++
+						}
+					}
+					errSum += absErr
+					report.Samples++
+				}
+				if !rainObserved {
+					continue
+				}
+
+				report.Rain.Samples++
+				forecastRain := IsRainCode(WeatherCode(hour.WeatherCode))
+				switch {
+				case forecastRain && rained:
+					report.Rain.Hits++
+				case !forecastRain && rained:
+					report.Rain.Misses++
+				case forecastRain && !rained:
+					report.Rain.FalseAlarms++
+				default:
+					report.Rain.CorrectNegatives++
+				}
+			}
+		}
+
+		for i, bucket := range leadTimeBuckets {
+			score := LeadTimeScore{
+				LeadTime: bucket.Label,
+				Samples:  errCounts[i],
+				MAEDesc:  "-",
+			}
+			if errCounts[i] > 0 {
+				score.MAE = errSums[i] / float64(errCounts[i])
+				score.MAEDesc = fmt.Sprintf(util.TEMP_FORMAT_ERR, score.MAE)
+			}
+			report.LeadTimes = append(report.LeadTimes, score)
+		}
+		if report.Samples > 0 {
+			report.MAE = errSum / float64(report.Samples)
+		}
+		if report.Rain.Samples > 0 {
+			report.Rain.Accuracy = float64(report.Rain.Hits+report.Rain.CorrectNegatives) / float64(report.Rain.Samples)
+		}
+		if report.Rain.Hits+report.Rain.Misses > 0 {
+			report.Rain.HitRate = float64(report.Rain.Hits) / float64(report.Rain.Hits+report.Rain.Misses)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// observedAt returns the temperature observed at t and whether it rained during the hour before t,
+// each with whether it was observed at all.
+func observedAt(observations []Observation, t time.Time) (float64, bool, bool, bool) {
+	var temp, precipitation float64
+	tempObserved, rainObserved := false, false
+	for _, observation := range observations {
+		if observed, ok := observation.Value("temp"); ok && observation.Time.Equal(t) {
+			temp = observed
+			tempObserved = true
+		}
+		if observed, ok := observation.Value("precipitation10m"); ok && observation.Time.After(t.Add(-time.Hour)) && !observation.Time.After(t) {
+			precipitation += observed
+			rainObserved = true
+		}
+	}
+	return temp, tempObserved, precipitation > 0, rainObserved
+}
+
+// ForecastAccuracyCheckQuery checks and validates query parameters for forecast accuracy widget requests.
+func ForecastAccuracyCheckQuery(c *gin.Context) (layout.WidgetSize, string, string, error) {
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	amedas_code := c.Query("location_histdata")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto forecastaccuracy_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.ForecastAccuracyWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto forecastaccuracy_checkquery_finish
+	}
+
+	if location_name == "" || amedas_code == "" {
+		err = fmt.Errorf("please provide location information with the amedas location code")
+		goto forecastaccuracy_checkquery_finish
+	}
+	if !ValidAmedasCode(amedas_code) {
+		err = fmt.Errorf("please provide a valid amedas location code")
+		goto forecastaccuracy_checkquery_finish
+	}
+
+forecastaccuracy_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, amedas_code, err
+}
@@ -0,0 +1,54 @@
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreForecastsSkipsMissingObservations(t *testing.T) {
+	tracker := NewForecastTracker(t.TempDir())
+	store := NewHistoryStore(t.TempDir())
+	issuedAt := time.Now().In(JST).Truncate(time.Hour).Add(-6 * time.Hour)
+	temp := func(value float64) *float64 { return &value }
+
+	snapshot := ForecastSnapshot{
+		Provider:     OPEN_METEO_JMA,
+		LocationName: "Fukuoka",
+		AmedasCode:   "82182",
+		IssuedAt:     issuedAt,
+		Hours: []ForecastHour{
+			{Time: issuedAt.Add(1 * time.Hour), Temp: 30},
+			{Time: issuedAt.Add(2 * time.Hour), Temp: 30},
+			{Time: issuedAt.Add(3 * time.Hour), Temp: 30},
+		},
+	}
+	if err := tracker.Record(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	// The second hour has no temperature and the third no observation at all.
+	err := store.Add("82182", []Observation{
+		{Time: issuedAt.Add(1 * time.Hour), Temp: temp(28), Precipitation10m: temp(0)},
+		{Time: issuedAt.Add(2 * time.Hour), Precipitation10m: temp(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := ScoreForecasts(tracker, store, "82182", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	report := reports[0]
+	if report.Samples != 1 || report.MAE != 2 {
+		t.Errorf("scored %d temperatures with a MAE of %.1f, want 1 with a MAE of 2.0", report.Samples, report.MAE)
+	}
+	if report.Rain.Samples != 2 || report.Rain.CorrectNegatives != 2 {
+		t.Errorf("scored the rain as %+v, want 2 correct negatives", report.Rain)
+	}
+	if report.LocationName != "Fukuoka" {
+		t.Errorf("reported the location as %q, want Fukuoka", report.LocationName)
+	}
+}
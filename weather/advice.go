@@ -0,0 +1,413 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ADVICE_OBSERVATION_MAX_AGE is how old an AMeDAS observation may be to replace the current forecast.
+const ADVICE_OBSERVATION_MAX_AGE = time.Hour
+
+// Daytime hours considered by the daily indices.
+const (
+	DAYTIME_START_HOUR = 9
+	DAYTIME_END_HOUR   = 18
+	LAUNDRY_END_HOUR   = 15
+)
+
+// AdviceLevel represents a level of an index, reached from its minimum value.
+type AdviceLevel struct {
+	Min   float64 `json:"min"`
+	Label string  `json:"label"`
+	Icon  string  `json:"icon"`
+}
+
+// WBGTRules represents the levels of the heat stroke index.
+type WBGTRules struct {
+	Levels    []AdviceLevel `json:"levels"`
+	AlertFrom float64       `json:"alert_from"`
+}
+
+// LaundryRules represents the levels and scoring of the laundry drying index.
+type LaundryRules struct {
+	Levels                []AdviceLevel `json:"levels"`
+	HumidityPenaltyFrom   float64       `json:"humidity_penalty_from"`
+	WindBonusFrom         float64       `json:"wind_bonus_from"`
+	RainProbabilityFrom   float64       `json:"rain_probability_from"`
+	RainPrecipitationFrom float64       `json:"rain_precipitation_from"`
+}
+
+// UmbrellaRules represents the thresholds of the umbrella recommendation.
+type UmbrellaRules struct {
+	ProbabilityFrom   float64 `json:"probability_from"`
+	PrecipitationFrom float64 `json:"precipitation_from"`
+}
+
+// ClothingRules represents the clothing suggested by apparent temperature.
+type ClothingRules struct {
+	Levels []AdviceLevel `json:"levels"`
+}
+
+// AdviceRules represents the thresholds of all lifestyle indices.
+type AdviceRules struct {
+	WBGT     WBGTRules     `json:"wbgt"`
+	Laundry  LaundryRules  `json:"laundry"`
+	Umbrella UmbrellaRules `json:"umbrella"`
+	Clothing ClothingRules `json:"clothing"`
+}
+
+// DefaultAdviceRules are the rules used when no rules file exists, following the guidelines of the
+// Ministry of the Environment for WBGT.
+var DefaultAdviceRules = AdviceRules{
+	WBGT: WBGTRules{
+		Levels: []AdviceLevel{
+			{31, "Danger", "emergency_heat"},
+			{28, "Severe warning", "warning"},
+			{25, "Warning", "thermostat"},
+			{21, "Caution", "info"},
+			{-100, "Almost safe", "check_circle"},
+		},
+		AlertFrom: 31,
+	},
+	Laundry: LaundryRules{
+		Levels: []AdviceLevel{
+			{80, "Dries well", "dry_cleaning"},
+			{50, "Dries slowly", "dry_cleaning"},
+			{20, "Hang indoors", "home"},
+			{-100, "Use a dryer", "local_laundry_service"},
+		},
+		HumidityPenaltyFrom:   60,
+		WindBonusFrom:         2,
+		RainProbabilityFrom:   40,
+		RainPrecipitationFrom: 0.5,
+	},
+	Umbrella: UmbrellaRules{
+		ProbabilityFrom:   50,
+		PrecipitationFrom: 1.0,
+	},
+	Clothing: ClothingRules{
+		Levels: []AdviceLevel{
+			{26, "T-shirt", "apparel"},
+			{21, "Long sleeves", "apparel"},
+			{16, "Cardigan", "checkroom"},
+			{12, "Sweater", "checkroom"},
+			{7, "Coat", "checkroom"},
+			{-100, "Winter coat", "ac_unit"},
+		},
+	},
+}
+
+// defaultAdviceRules returns a copy of DefaultAdviceRules whose levels do not share memory with them.
+func defaultAdviceRules() AdviceRules {
+	rules := DefaultAdviceRules
+	rules.WBGT.Levels = slices.Clone(DefaultAdviceRules.WBGT.Levels)
+	rules.Laundry.Levels = slices.Clone(DefaultAdviceRules.Laundry.Levels)
+	rules.Clothing.Levels = slices.Clone(DefaultAdviceRules.Clothing.Levels)
+	return rules
+}
+
+// LoadAdviceRules loads the thresholds of the lifestyle indices, or the defaults if the file does not exist.
+// The thresholds left out of the file keep their default, and the levels given in the file replace the default ones as a whole.
+func LoadAdviceRules(path string) (AdviceRules, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return defaultAdviceRules(), nil
+	} else if err != nil {
+		return defaultAdviceRules(), fmt.Errorf("failed to read advice rules: %v", err)
+	}
+
+	rules := DefaultAdviceRules
+	rules.WBGT.Levels, rules.Laundry.Levels, rules.Clothing.Levels = nil, nil, nil
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return defaultAdviceRules(), fmt.Errorf("failed to unmarshal advice rules: %v", err)
+	}
+	defaults := defaultAdviceRules()
+	if rules.WBGT.Levels == nil {
+		rules.WBGT.Levels = defaults.WBGT.Levels
+	}
+	if rules.Laundry.Levels == nil {
+		rules.Laundry.Levels = defaults.Laundry.Levels
+	}
+	if rules.Clothing.Levels == nil {
+		rules.Clothing.Levels = defaults.Clothing.Levels
+	}
+	return rules, nil
+}
+
+// levelOf returns the first level, ordered from the highest, whose minimum the value reaches.
+func levelOf(levels []AdviceLevel, value float64) AdviceLevel {
+	for _, level := range levels {
+		if value >= level.Min {
+			return level
+		}
+	}
+	return AdviceLevel{Label: "-", Icon: "help"}
+}
+
+// EstimateWBGT estimates the wet-bulb globe temperature from the air temperature (°C), relative humidity (%),
+// global solar radiation (kW/m²) and wind speed (m/s) with the regression of Ono and Tonouchi (2014).
+func EstimateWBGT(temp, humidity, radiation, wind float64) float64 {
+	return 0.735*temp + 0.0374*humidity + 0.00292*temp*humidity + 7.619*radiation - 4.557*radiation*radiation - 0.0572*wind - 4.064
+}
+
+// Advice represents the lifestyle indices of a location for display.
+type Advice struct {
+	WBGT          string `json:"wbgt"`
+	WBGTLevel     string `json:"wbgt_level"`
+	WBGTIcon      string `json:"wbgt_icon"`
+	WBGTMax       string `json:"wbgt_max"`
+	WBGTMaxLevel  string `json:"wbgt_max_level"`
+	WBGTMaxTime   string `json:"wbgt_max_time"`
+	Laundry       string `json:"laundry"`
+	LaundryLevel  string `json:"laundry_level"`
+	LaundryIcon   string `json:"laundry_icon"`
+	Umbrella      bool   `json:"umbrella"`
+	UmbrellaLabel string `json:"umbrella_label"`
+	UmbrellaIcon  string `json:"umbrella_icon"`
+	Clothing      string `json:"clothing"`
+	ClothingIcon  string `json:"clothing_icon"`
+	Alert         string `json:"alert"`
+}
+
+// optionalAt returns the i-th value, or false when the model does not provide it.
+func optionalAt(values []*float64, i int) (float64, bool) {
+	if i >= len(values) || values[i] == nil {
+		return 0, false
+	}
+	return *values[i], true
+}
+
+// valueAt returns the i-th value, or false when it is missing from the response.
+func valueAt(values []float64, i int) (float64, bool) {
+	if i >= len(values) {
+		return 0, false
+	}
+	return values[i], true
+}
+
+// laundryHourScore scores how well laundry dries during an hour, from 0 to 100.
+func laundryHourScore(data RawHourlyData, i int, rules LaundryRules) float64 {
+	var score float64
+	switch code := WeatherCode(data.WeatherCode[i]); {
+	case code == ClearSky || code == MainlyClear:
+		score = 100
+	case code == PartlyCloudy:
+		score = 85
+	case code == Overcast:
+		score = 60
+	case code == Fog || code == DepositingRimeFog:
+		score = 40
+	default:
+		score = 0
+	}
+	if humidity, ok := optionalAt(data.RelativeHumidity2M, i); ok && humidity > rules.HumidityPenaltyFrom {
+		score -= (humidity - rules.HumidityPenaltyFrom) * 1.5
+	}
+	if wind, ok := optionalAt(data.WindSpeed10M, i); ok && wind >= rules.WindBonusFrom {
+		score += math.Min((wind-rules.WindBonusFrom)*5, 15)
+	}
+	precipitation, _ := optionalAt(data.Precipitation, i)
+	probability, _ := optionalAt(data.PrecipitationProbability, i)
+	if precipitation >= rules.RainPrecipitationFrom || probability >= rules.RainProbabilityFrom {
+		score = math.Min(score, 10)
+	}
+	return math.Max(0, math.Min(100, score))
+}
+
+// ComputeAdvice derives the heat stroke index, laundry drying index, umbrella recommendation and clothing
+// suggestion of the day from the forecast. A recent AMeDAS observation, if given, replaces the current forecast.
+func ComputeAdvice(data RawForecastData, latest *Observation, rules AdviceRules, now time.Time) (Advice, error) {
+	var advice Advice
+	var laundryScores, apparentTemps []float64
+	var radiationNow float64
+	wbgtMax := math.Inf(-1)
+	umbrellaProbability, umbrellaPrecipitation := 0.0, 0.0
+
+	location, err := time.LoadLocation(data.Timezone)
+	if err != nil {
+		return advice, fmt.Errorf("invalid time zone \"%s\"", data.Timezone)
+	}
+	now = now.In(location)
+
+	for i, datetimeStr := range data.Hourly.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", datetimeStr, location)
+		if err != nil {
+			return advice, fmt.Errorf("invalid forecast time \"%s\"", datetimeStr)
+		}
+		if t.YearDay() != now.YearDay() || t.Year() != now.Year() {
+			continue
+		}
+		radiation, _ := optionalAt(data.Hourly.ShortwaveRadiation, i)
+		radiation /= 1000
+		if t.Hour() == now.Hour() {
+			radiationNow = radiation
+		}
+
+		temp, okTemp := valueAt(data.Hourly.Temperature2M, i)
+		humidity, okHumidity := optionalAt(data.Hourly.RelativeHumidity2M, i)
+		wind, _ := optionalAt(data.Hourly.WindSpeed10M, i)
+		if okTemp && okHumidity && !t.Before(now.Truncate(time.Hour)) {
+			if wbgt := EstimateWBGT(temp, humidity, radiation, wind); wbgt > wbgtMax {
+				wbgtMax = wbgt
+				advice.WBGTMaxTime = t.Format("15:04")
+			}
+		}
+
+		if t.Hour() < DAYTIME_START_HOUR || t.Hour() >= DAYTIME_END_HOUR {
+			continue
+		}
+		if t.Hour() < LAUNDRY_END_HOUR && i < len(data.Hourly.WeatherCode) {
+			laundryScores = append(laundryScores, laundryHourScore(data.Hourly, i, rules.Laundry))
+		}
+		if apparentTemp, ok := optionalAt(data.Hourly.ApparentTemperature, i); ok {
+			apparentTemps = append(apparentTemps, apparentTemp)
+		}
+		if !t.Before(now.Truncate(time.Hour)) {
+			probability, _ := optionalAt(data.Hourly.PrecipitationProbability, i)
+			precipitation, _ := optionalAt(data.Hourly.Precipitation, i)
+			umbrellaProbability = math.Max(umbrellaProbability, probability)
+			umbrellaPrecipitation = math.Max(umbrellaPrecipitation, precipitation)
+		}
+	}
+
+	// Heat stroke index now, preferring the observed temperature, humidity and wind to the forecast ones.
+	// Without any humidity it is left unknown, while a missing wind counts as calm.
+	var humidity, wind float64
+	temp := data.Current.Temperature2M
+	okHumidity := data.Current.RelativeHumidity2M != nil
+	if okHumidity {
+		humidity = *data.Current.RelativeHumidity2M
+	}
+	if data.Current.WindSpeed10M != nil {
+		wind = *data.Current.WindSpeed10M
+	}
+	if latest != nil && now.Sub(latest.Time) <= ADVICE_OBSERVATION_MAX_AGE {
+		if observed, ok := latest.Value("temp"); ok {
+			temp = observed
+		}
+		if observed, ok := latest.Value("humidity"); ok {
+			humidity, okHumidity = observed, true
+		}
+		if observed, ok := latest.Value("wind"); ok {
+			wind = observed
+		}
+	}
+	advice.WBGT, advice.WBGTLevel, advice.WBGTIcon = "-", "-", "help"
+	if okHumidity {
+		wbgt := EstimateWBGT(temp, humidity, radiationNow, wind)
+		wbgtLevel := levelOf(rules.WBGT.Levels, wbgt)
+		advice.WBGT = fmt.Sprintf("%.1f", wbgt)
+		advice.WBGTLevel = wbgtLevel.Label
+		advice.WBGTIcon = wbgtLevel.Icon
+		if wbgt >= rules.WBGT.AlertFrom {
+			advice.Alert = fmt.Sprintf("Heat stroke risk: WBGT %.0f (%s)", wbgt, wbgtLevel.Label)
+		}
+	}
+	advice.WBGTMax, advice.WBGTMaxLevel = "-", "-"
+	if !math.IsInf(wbgtMax, -1) {
+		advice.WBGTMax = fmt.Sprintf("%.1f", wbgtMax)
+		advice.WBGTMaxLevel = levelOf(rules.WBGT.Levels, wbgtMax).Label
+	}
+
+	// Laundry drying index of the daytime.
+	advice.Laundry, advice.LaundryLevel, advice.LaundryIcon = "-", "-", "help"
+	if len(laundryScores) > 0 {
+		laundry := mean(laundryScores)
+		laundryLevel := levelOf(rules.Laundry.Levels, laundry)
+		advice.Laundry = strconv.Itoa(int(math.Round(laundry)))
+		advice.LaundryLevel = laundryLevel.Label
+		advice.LaundryIcon = laundryLevel.Icon
+	}
+
+	// Umbrella recommendation for the rest of the day.
+	advice.Umbrella = umbrellaProbability >= rules.Umbrella.ProbabilityFrom || umbrellaPrecipitation >= rules.Umbrella.PrecipitationFrom
+	advice.UmbrellaLabel, advice.UmbrellaIcon = "No umbrella needed", "wb_sunny"
+	if advice.Umbrella {
+		advice.UmbrellaLabel, advice.UmbrellaIcon = "Take an umbrella", "umbrella"
+	}
+
+	// Clothing suggestion from the daytime apparent temperature.
+	advice.Clothing, advice.ClothingIcon = "-", "help"
+	if len(apparentTemps) > 0 {
+		clothingLevel := levelOf(rules.Clothing.Levels, mean(apparentTemps))
+		advice.Clothing = clothingLevel.Label
+		advice.ClothingIcon = clothingLevel.Icon
+	}
+	return advice, nil
+}
+
+// mean returns the mean of the values.
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// LatestObservation returns the latest stored AMeDAS observation of the station, or nil if there is none.
+func LatestObservation(store *HistoryStore, amedas_code string, now time.Time) *Observation {
+	if amedas_code == "" {
+		return nil
+	}
+	observations, err := store.Range(amedas_code, now.Add(-ADVICE_OBSERVATION_MAX_AGE), now)
+	if err != nil || len(observations) == 0 {
+		return nil
+	}
+	return &observations[len(observations)-1]
+}
+
+// AdviceCheckQuery checks and validates query parameters for lifestyle advice requests.
+func AdviceCheckQuery(c *gin.Context) (layout.WidgetSize, string, float64, float64, string, error) {
+	var latitude, longitude float64
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	latitude_str := c.Query("location_latitude")
+	longitude_str := c.Query("location_longitude")
+	amedas_code := c.Query("location_histdata")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto advice_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.AdviceWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto advice_checkquery_finish
+	}
+
+	if location_name == "" || latitude_str == "" || longitude_str == "" {
+		err = fmt.Errorf("please provide location information")
+		goto advice_checkquery_finish
+	}
+	latitude, err = strconv.ParseFloat(latitude_str, 64)
+	if err != nil {
+		err = fmt.Errorf("please provide valid latitude information")
+		goto advice_checkquery_finish
+	}
+	longitude, err = strconv.ParseFloat(longitude_str, 64)
+	if err != nil {
+		err = fmt.Errorf("please provide valid longitude information")
+		goto advice_checkquery_finish
+	}
+	if amedas_code != "" && !ValidAmedasCode(amedas_code) {
+		err = fmt.Errorf("please provide a valid amedas location code")
+		goto advice_checkquery_finish
+	}
+
+advice_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, latitude, longitude, amedas_code, err
+}
@@ -0,0 +1,42 @@
+package weather
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadAdviceRules(t *testing.T) {
+	defaults := defaultAdviceRules()
+	path := filepath.Join(t.TempDir(), "advice.json")
+
+	// A broken file falls back to untouched defaults.
+	os.WriteFile(path, []byte(`{"wbgt":{"levels":[{"min":99,"label":"X"}]},"umbrella":"oops"}`), 0644)
+	rules, err := LoadAdviceRules(path)
+	if err == nil {
+		t.Errorf("loaded a broken rules file without an error")
+	}
+	if !reflect.DeepEqual(rules, defaults) || !reflect.DeepEqual(DefaultAdviceRules, defaults) {
+		t.Errorf("a broken rules file changed the default rules")
+	}
+
+	// Levels replace the default ones as a whole, and the thresholds left out keep their default.
+	os.WriteFile(path, []byte(`{"wbgt":{"levels":[{"min":99,"label":"X"}]},"umbrella":{"probability_from":70}}`), 0644)
+	rules, err = LoadAdviceRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []AdviceLevel{{Min: 99, Label: "X"}}; !reflect.DeepEqual(rules.WBGT.Levels, want) {
+		t.Errorf("WBGT levels = %v, want %v", rules.WBGT.Levels, want)
+	}
+	if rules.WBGT.AlertFrom != defaults.WBGT.AlertFrom || rules.Umbrella.PrecipitationFrom != defaults.Umbrella.PrecipitationFrom {
+		t.Errorf("the thresholds left out did not keep their default")
+	}
+	if rules.Umbrella.ProbabilityFrom != 70 || !reflect.DeepEqual(rules.Clothing, defaults.Clothing) {
+		t.Errorf("rules = %+v, want the given umbrella probability and the default clothing", rules)
+	}
+	if !reflect.DeepEqual(DefaultAdviceRules, defaults) {
+		t.Errorf("a rules file changed the default rules")
+	}
+}
@@ -0,0 +1,248 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kken7231/screensaver/layout"
+	"github.com/kken7231/screensaver/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AIR_QUALITY_VARIABLES are the current variables requested from the Open Meteo air quality API.
+const AIR_QUALITY_VARIABLES = "us_aqi,pm2_5,pm10,ozone,alder_pollen,birch_pollen,grass_pollen,mugwort_pollen,olive_pollen,ragweed_pollen"
+
+// AIR_QUALITY_HOURS is the number of forthcoming hours of AQI shown by the widget.
+const AIR_QUALITY_HOURS = 6
+
+// AQILevel represents a level of the US AQI with its color from the Material palette.
+type AQILevel struct {
+	Max   float64
+	Name  string
+	Color string
+}
+
+// aqiLevels are the levels of the US AQI, colored with the Material Green, Yellow, Orange, Red, Purple and Brown 500.
+var aqiLevels = []AQILevel{
+	{50, "Good", "#4caf50"},
+	{100, "Moderate", "#ffeb3b"},
+	{150, "Unhealthy for sensitive groups", "#ff9800"},
+	{200, "Unhealthy", "#f44336"},
+	{300, "Very unhealthy", "#9c27b0"},
+	{-1, "Hazardous", "#795548"},
+}
+
+// GetAQILevel returns the level of a US AQI value.
+func GetAQILevel(aqi float64) AQILevel {
+	for _, level := range aqiLevels {
+		if aqi <= level.Max {
+			return level
+		}
+	}
+	return aqiLevels[len(aqiLevels)-1]
+}
+
+// RawAirQualityCurrent represents the current air quality data.
+// Pollen is only modelled in Europe and is null elsewhere.
+type RawAirQualityCurrent struct {
+	USAQI         *float64 `json:"us_aqi"`
+	PM25          *float64 `json:"pm2_5"`
+	PM10          *float64 `json:"pm10"`
+	Ozone         *float64 `json:"ozone"`
+	AlderPollen   *float64 `json:"alder_pollen"`
+	BirchPollen   *float64 `json:"birch_pollen"`
+	GrassPollen   *float64 `json:"grass_pollen"`
+	MugwortPollen *float64 `json:"mugwort_pollen"`
+	OlivePollen   *float64 `json:"olive_pollen"`
+	RagweedPollen *float64 `json:"ragweed_pollen"`
+}
+
+// RawAirQualityHourly represents the hourly air quality data.
+type RawAirQualityHourly struct {
+	Time  []string   `json:"time"`
+	USAQI []*float64 `json:"us_aqi"`
+}
+
+// RawAirQualityData represents the complete air quality data.
+type RawAirQualityData struct {
+	Timezone string               `json:"timezone"`
+	Current  RawAirQualityCurrent `json:"current"`
+	Hourly   RawAirQualityHourly  `json:"hourly"`
+	Reason   string               `json:"reason,omitempty"`
+}
+
+// HourlyAirQuality represents the AQI of an hour for display.
+type HourlyAirQuality struct {
+	Time  string `json:"time"`
+	AQI   string `json:"aqi"`
+	Color string `json:"color"`
+}
+
+// AirQualityData represents the air quality for display.
+type AirQualityData struct {
+	AQI      string             `json:"aqi"`
+	AQILevel string             `json:"aqi_level"`
+	AQIColor string             `json:"aqi_color"`
+	PM25     string             `json:"pm25"`
+	PM10     string             `json:"pm10"`
+	Ozone    string             `json:"ozone"`
+	Pollen   string             `json:"pollen"`
+	Hourly   []HourlyAirQuality `json:"hourly"`
+}
+
+// formatPointer formats a value, or returns "-" when the model does not provide it.
+func formatPointer(format string, value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format, *value)
+}
+
+// FetchAirQualityData fetches the current and hourly air quality from the Open Meteo air quality API.
+func FetchAirQualityData(ctx context.Context, client *http.Client, latitude, longitude float64) (RawAirQualityData, error) {
+	var result RawAirQualityData
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var body []byte
+
+	url := fmt.Sprintf("https://air-quality-api.open-meteo.com/v1/air-quality?latitude=%f&longitude=%f&current=%s&hourly=us_aqi&timezone=auto&forecast_days=2",
+		latitude,
+		longitude,
+		AIR_QUALITY_VARIABLES,
+	)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create a request for air quality data: %v", err)
+		goto weather_fetchairqualitydata_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch air quality data (url: %s): %v", url, err)
+		goto weather_fetchairqualitydata_finish
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read air quality data body (url: %s)", url)
+		goto weather_fetchairqualitydata_finish
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		err = fmt.Errorf("failed to unmarshal air quality data json (url: %s)", url)
+		goto weather_fetchairqualitydata_finish
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch air quality data (url: %s): %s %s", url, resp.Status, result.Reason)
+		goto weather_fetchairqualitydata_finish
+	}
+
+weather_fetchairqualitydata_finish:
+	return result, err
+}
+
+// ParseAirQualityData parses the air quality data for display, with the AQI of the next nHour hours.
+func ParseAirQualityData(data RawAirQualityData, nHour int) (AirQualityData, error) {
+	var airQualityData AirQualityData
+	var pollens []string
+
+	if data.Current.USAQI == nil {
+		return airQualityData, fmt.Errorf("no AQI found in the air quality data")
+	}
+
+	level := GetAQILevel(*data.Current.USAQI)
+	airQualityData = AirQualityData{
+		AQI:      fmt.Sprintf(util.AQI_FORMAT, *data.Current.USAQI),
+		AQILevel: level.Name,
+		AQIColor: level.Color,
+		PM25:     formatPointer(util.CONCENTRATION_FORMAT, data.Current.PM25),
+		PM10:     formatPointer(util.CONCENTRATION_FORMAT, data.Current.PM10),
+		Ozone:    formatPointer(util.CONCENTRATION_FORMAT, data.Current.Ozone),
+		Pollen:   "-",
+		Hourly:   []HourlyAirQuality{},
+	}
+
+	// Only the pollens present at the location are listed.
+	for _, pollen := range []struct {
+		name  string
+		value *float64
+	}{
+		{"Alder", data.Current.AlderPollen},
+		{"Birch", data.Current.BirchPollen},
+		{"Grass", data.Current.GrassPollen},
+		{"Mugwort", data.Current.MugwortPollen},
+		{"Olive", data.Current.OlivePollen},
+		{"Ragweed", data.Current.RagweedPollen},
+	} {
+		if pollen.value != nil && *pollen.value >= 1 {
+			pollens = append(pollens, pollen.name+" "+fmt.Sprintf(util.POLLEN_FORMAT, *pollen.value))
+		}
+	}
+	if len(pollens) > 0 {
+		airQualityData.Pollen = strings.Join(pollens, ", ")
+	}
+
+	nextHours, err := FindNextNHours(data.Hourly.Time, data.Timezone, nHour)
+	if err != nil {
+		return airQualityData, fmt.Errorf("failed to find the next coming %d hours in the air quality data", nHour)
+	}
+	for _, nextData := range nextHours {
+		hourly := HourlyAirQuality{Time: strconv.Itoa(nextData.Time), AQI: "-", Color: "transparent"}
+		if nextData.Index < len(data.Hourly.USAQI) && data.Hourly.USAQI[nextData.Index] != nil {
+			aqi := *data.Hourly.USAQI[nextData.Index]
+			hourly.AQI = fmt.Sprintf(util.AQI_FORMAT, aqi)
+			hourly.Color = GetAQILevel(aqi).Color
+		}
+		airQualityData.Hourly = append(airQualityData.Hourly, hourly)
+	}
+	return airQualityData, nil
+}
+
+// AirQualityCheckQuery checks and validates query parameters for air quality requests.
+func AirQualityCheckQuery(c *gin.Context) (layout.WidgetSize, string, float64, float64, error) {
+	var latitude, longitude float64
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	latitude_str := c.Query("location_latitude")
+	longitude_str := c.Query("location_longitude")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto airquality_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.AirQualityWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto airquality_checkquery_finish
+	}
+
+	if location_name == "" || latitude_str == "" || longitude_str == "" {
+		err = fmt.Errorf("please provide location information")
+		goto airquality_checkquery_finish
+	}
+	latitude, err = strconv.ParseFloat(latitude_str, 64)
+	if err != nil {
+		err = fmt.Errorf("please provide valid latitude information")
+		goto airquality_checkquery_finish
+	}
+	longitude, err = strconv.ParseFloat(longitude_str, 64)
+	if err != nil {
+		err = fmt.Errorf("please provide valid longitude information")
+		goto airquality_checkquery_finish
+	}
+
+airquality_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, latitude, longitude, err
+}
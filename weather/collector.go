@@ -0,0 +1,216 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+)
+
+// AMEDAS_COLLECT_INTERVAL is the interval between two collections of AMeDAS observations.
+const AMEDAS_COLLECT_INTERVAL = 10 * time.Minute
+
+// AMEDAS_BACKFILL_DAYS is the number of past days collected when the collector starts.
+const AMEDAS_BACKFILL_DAYS = 10
+
+// AMEDAS_CHUNK_SIZE is the number of observations in a complete 3-hour chunk (every 10 minutes).
+const AMEDAS_CHUNK_SIZE = 18
+
+// AmedasStations returns the AMeDAS codes used by the widgets of every layout.
+func AmedasStations() ([]string, error) {
+	var stations []string
+
+	layouts, err := layout.ListLayouts()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layouts {
+		for _, widget := range l.AllWidgets() {
+			amedas_code, ok := widget.Data["location_histdata"].(string)
+			if ok && amedas_code != "" && !slices.Contains(stations, amedas_code) {
+				stations = append(stations, amedas_code)
+			}
+		}
+	}
+	return stations, nil
+}
+
+// CollectAmedasObservations ingests the observations of the last nDay days into the store.
+// Chunks already complete in the store are not downloaded again.
+func CollectAmedasObservations(ctx context.Context, client *http.Client, store *HistoryStore, now time.Time, nDay int) {
+	stations, err := AmedasStations()
+	if err != nil {
+		log.Printf("Failed to list AMeDAS stations: %v", err)
+		return
+	}
+
+	now = now.In(JST)
+	for _, amedas_code := range stations {
+		for d := nDay - 1; d >= 0; d-- {
+			day := now.AddDate(0, 0, -d)
+			lastQuarter := 7
+			if d == 0 {
+				lastQuarter = now.Hour() / 3
+			}
+			for i := 0; i <= lastQuarter; i++ {
+				chunkStart := time.Date(day.Year(), day.Month(), day.Day(), i*3, 0, 0, 0, JST)
+				count, err := store.Count(amedas_code, chunkStart, chunkStart.Add(3*time.Hour))
+				if err != nil {
+					log.Printf("Failed to read AMeDAS history of %s: %v", amedas_code, err)
+					continue
+				}
+				if count >= AMEDAS_CHUNK_SIZE {
+					continue
+				}
+
+				rawHistData, err := FetchHistWeatherData(ctx, client, amedas_code, day, i)
+				if errors.Is(err, ErrNotPublished) {
+					continue
+				} else if err != nil {
+					log.Printf("Failed to collect AMeDAS observations: %v", err)
+					continue
+				}
+				observations, err := ParseObservations(rawHistData)
+				if err != nil {
+					log.Printf("Failed to parse AMeDAS observations of %s: %v", amedas_code, err)
+					continue
+				}
+				if err = store.Add(amedas_code, observations); err != nil {
+					log.Printf("Failed to store AMeDAS observations of %s: %v", amedas_code, err)
+				}
+			}
+		}
+	}
+}
+
+// StartAmedasCollector starts collecting AMeDAS observations into the store in the background.
+// It backfills the days JMA still keeps, then refreshes the recent chunks at every interval.
+func StartAmedasCollector(ctx context.Context, client *http.Client, store *HistoryStore, interval time.Duration) {
+	go func() {
+		CollectAmedasObservations(ctx, client, store, time.Now(), AMEDAS_BACKFILL_DAYS)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				// Include yesterday so the chunk spanning midnight is completed.
+				CollectAmedasObservations(ctx, client, store, now, 2)
+			}
+		}
+	}()
+}
+
+// FORECAST_COLLECT_INTERVAL is the interval between two snapshots of the tracked forecasts.
+const FORECAST_COLLECT_INTERVAL = time.Hour
+
+// FORECAST_SNAPSHOT_DAYS is the number of forecast days after today fetched for a snapshot, covering FORECAST_SNAPSHOT_HOURS.
+const FORECAST_SNAPSHOT_DAYS = 2
+
+// ForecastLocation represents a location whose forecasts are scored against an AMeDAS station.
+type ForecastLocation struct {
+	Name       string
+	Latitude   float64
+	Longitude  float64
+	Timezone   string
+	AmedasCode string
+}
+
+// ForecastLocations returns the locations with coordinates and an AMeDAS code used by the widgets of every layout,
+// one per station.
+func ForecastLocations() ([]ForecastLocation, error) {
+	var locations []ForecastLocation
+
+	layouts, err := layout.ListLayouts()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layouts {
+		for _, widget := range l.AllWidgets() {
+			if err := widget.ResolveLocations(); err != nil {
+				log.Printf("Unable to resolve the location of %s: %v", widget.GetId(), err)
+			}
+			location_name, _ := widget.Data["location_name"].(string)
+			latitude, hasLatitude := widget.Data["location_latitude"].(float64)
+			longitude, hasLongitude := widget.Data["location_longitude"].(float64)
+			amedas_code, _ := widget.Data["location_histdata"].(string)
+			location_timezone, _ := widget.Data["location_timezone"].(string)
+			timezone, err := LocationTimezone(location_timezone)
+			if !hasLatitude || !hasLongitude || amedas_code == "" || err != nil {
+				continue
+			}
+			if slices.ContainsFunc(locations, func(location ForecastLocation) bool { return location.AmedasCode == amedas_code }) {
+				continue
+			}
+			locations = append(locations, ForecastLocation{
+				Name:       location_name,
+				Latitude:   latitude,
+				Longitude:  longitude,
+				Timezone:   timezone,
+				AmedasCode: amedas_code,
+			})
+		}
+	}
+	return locations, nil
+}
+
+// CollectForecastSnapshots fetches the forecasts of every tracked location and records their snapshots.
+func CollectForecastSnapshots(ctx context.Context, client *http.Client, tracker *ForecastTracker, now time.Time) {
+	locations, err := ForecastLocations()
+	if err != nil {
+		log.Printf("Failed to list forecast locations: %v", err)
+		return
+	}
+	if len(locations) == 0 {
+		return
+	}
+
+	var latitudes, longitudes []float64
+	var timezones []string
+	for _, location := range locations {
+		latitudes = append(latitudes, location.Latitude)
+		longitudes = append(longitudes, location.Longitude)
+		timezones = append(timezones, location.Timezone)
+	}
+	results, err := FetchForecastDataBatch(ctx, client, latitudes, longitudes, timezones, FORECAST_SNAPSHOT_DAYS)
+	if err != nil {
+		log.Printf("Failed to collect forecast snapshots: %v", err)
+		return
+	}
+	for i, location := range locations {
+		if i >= len(results) {
+			break
+		}
+		snapshot, err := SnapshotForecast(results[i], OPEN_METEO_JMA, location.Name, location.AmedasCode, now)
+		if err == nil {
+			err = tracker.Record(snapshot)
+		}
+		if err != nil {
+			log.Printf("Failed to record the forecast snapshot of %s: %v", location.Name, err)
+		}
+	}
+}
+
+// StartForecastCollector starts recording snapshots of the tracked forecasts in the background at every interval,
+// whichever widgets show them.
+func StartForecastCollector(ctx context.Context, client *http.Client, tracker *ForecastTracker, interval time.Duration) {
+	go func() {
+		CollectForecastSnapshots(ctx, client, tracker, time.Now())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				CollectForecastSnapshots(ctx, client, tracker, now)
+			}
+		}
+	}()
+}
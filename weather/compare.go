@@ -0,0 +1,90 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kken7231/screensaver/layout"
+	"github.com/kken7231/screensaver/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompareLocation represents one location of the weather comparison widget.
+type CompareLocation struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+}
+
+// CompareRow represents the weather of one location in the comparison table.
+type CompareRow struct {
+	Name                     string `json:"name"`
+	Temp                     string `json:"temp"`
+	WeatherIcon              string `json:"weather_icon"`
+	WeatherName              string `json:"weather_name"`
+	TempMax                  string `json:"temp_max"`
+	TempMin                  string `json:"temp_min"`
+	PrecipitationProbability string `json:"precipitation_probability"`
+}
+
+// WeatherCompareCheckQuery checks and validates query parameters for weather comparison requests.
+func WeatherCompareCheckQuery(c *gin.Context) (layout.WidgetSize, []CompareLocation, error) {
+	var locations []CompareLocation
+	var err error
+
+	size_str := c.Query("size")
+	locations_str := c.Query("locations")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto weathercompare_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.WeatherCompareWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto weathercompare_checkquery_finish
+	}
+
+	if locations_str == "" {
+		err = fmt.Errorf("please provide location information")
+		goto weathercompare_checkquery_finish
+	}
+	if err = json.Unmarshal([]byte(locations_str), &locations); err != nil || len(locations) == 0 {
+		err = fmt.Errorf("please provide valid location information")
+		goto weathercompare_checkquery_finish
+	}
+	for i := range locations {
+		if locations[i].Timezone, err = LocationTimezone(locations[i].Timezone); err != nil {
+			goto weathercompare_checkquery_finish
+		}
+	}
+
+weathercompare_checkquery_finish:
+	return (layout.WidgetSize)(size_str), locations, err
+}
+
+// ParseCompareRow parses the forecast data of one location into a comparison row.
+func ParseCompareRow(name string, data RawForecastData) (CompareRow, error) {
+	forecastData, err := ParseForecastData(data, 1, 1)
+	if err != nil {
+		return CompareRow{}, err
+	}
+
+	// Fall back to the precipitation amount when the model has no probability.
+	precipitation := forecastData.Today.PrecipitationProbability
+	if precipitation == util.MISSING_VALUE {
+		precipitation = forecastData.Today.Precipitation
+	}
+
+	return CompareRow{
+		Name:                     name,
+		Temp:                     forecastData.Current.Temp,
+		WeatherIcon:              forecastData.Current.WeatherIcon,
+		WeatherName:              forecastData.Current.WeatherName,
+		TempMax:                  forecastData.Today.TempMax,
+		TempMin:                  forecastData.Today.TempMin,
+		PrecipitationProbability: precipitation,
+	}, nil
+}
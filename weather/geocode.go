@@ -0,0 +1,195 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kken7231/screensaver/layout"
+)
+
+// RawGeocodingResult represents a single result of the Open Meteo geocoding API.
+type RawGeocodingResult struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+	Admin1    string  `json:"admin1"`
+}
+
+// RawGeocodingResponse represents the response of the Open Meteo geocoding API.
+type RawGeocodingResponse struct {
+	Results []RawGeocodingResult `json:"results"`
+	Reason  string               `json:"reason,omitempty"`
+}
+
+// postalCodeRegex matches Japanese postal codes such as "810-0001" or "8100001".
+var postalCodeRegex = regexp.MustCompile(`^〒?\s*(\d{3})-?(\d{4})$`)
+
+// FetchGeocodingData searches a place name or postal code with the Open Meteo geocoding API.
+func FetchGeocodingData(ctx context.Context, client *http.Client, query string) (RawGeocodingResponse, error) {
+	var result RawGeocodingResponse
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var body []byte
+
+	// Postal codes are searched in their hyphenated form.
+	if matches := postalCodeRegex.FindStringSubmatch(query); matches != nil {
+		query = matches[1] + "-" + matches[2]
+	}
+
+	url := fmt.Sprintf("https://geocoding-api.open-meteo.com/v1/search?name=%s&count=1&language=ja&countryCode=JP&format=json",
+		url.QueryEscape(query),
+	)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create a request for geocoding data: %v", err)
+		goto weather_fetchgeocodingdata_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch geocoding data (url: %s): %v", url, err)
+		goto weather_fetchgeocodingdata_finish
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read geocoding data body (url: %s)", url)
+		goto weather_fetchgeocodingdata_finish
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		err = fmt.Errorf("failed to unmarshal geocoding data json (url: %s)", url)
+		goto weather_fetchgeocodingdata_finish
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch geocoding data (url: %s): %s %s", url, resp.Status, result.Reason)
+		goto weather_fetchgeocodingdata_finish
+	}
+
+weather_fetchgeocodingdata_finish:
+	return result, err
+}
+
+// ResolveLocation resolves a place name or postal code into coordinates and a time zone.
+// Resolutions are cached in the layout store. When the geocoding API is unavailable or
+// finds nothing, the bundled gazetteer of prefectural capitals is used.
+func ResolveLocation(ctx context.Context, client *http.Client, query string) (layout.ResolvedLocation, error) {
+	if location, ok := layout.CachedLocation(query); ok {
+		return location, nil
+	}
+
+	var location layout.ResolvedLocation
+	response, err := FetchGeocodingData(ctx, client, query)
+	if err == nil && len(response.Results) > 0 {
+		result := response.Results[0]
+		location = layout.ResolvedLocation{
+			Name:      result.Name,
+			Latitude:  result.Latitude,
+			Longitude: result.Longitude,
+			Timezone:  result.Timezone,
+		}
+	} else {
+		var ok bool
+		location, ok = LookupGazetteer(query)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("no location found for \"%s\"", query)
+			}
+			return location, err
+		}
+	}
+
+	if err := layout.CacheLocation(query, location); err != nil {
+		log.Printf("Failed to cache the location of \"%s\": %v", query, err)
+	}
+	return location, nil
+}
+
+// GazetteerEntry represents a place in the bundled offline gazetteer.
+type GazetteerEntry struct {
+	Name      string
+	NameJP    string
+	Latitude  float64
+	Longitude float64
+}
+
+// gazetteer lists the prefectural capitals of Japan.
+var gazetteer = []GazetteerEntry{
+	{"Sapporo", "札幌", 43.06, 141.35},
+	{"Aomori", "青森", 40.82, 140.74},
+	{"Morioka", "盛岡", 39.70, 141.15},
+	{"Sendai", "仙台", 38.27, 140.87},
+	{"Akita", "秋田", 39.72, 140.10},
+	{"Yamagata", "山形", 38.24, 140.36},
+	{"Fukushima", "福島", 37.75, 140.47},
+	{"Mito", "水戸", 36.37, 140.47},
+	{"Utsunomiya", "宇都宮", 36.56, 139.88},
+	{"Maebashi", "前橋", 36.39, 139.06},
+	{"Saitama", "さいたま", 35.86, 139.65},
+	{"Chiba", "千葉", 35.61, 140.12},
+	{"Tokyo", "東京", 35.69, 139.69},
+	{"Yokohama", "横浜", 35.44, 139.64},
+	{"Niigata", "新潟", 37.90, 139.02},
+	{"Toyama", "富山", 36.70, 137.21},
+	{"Kanazawa", "金沢", 36.59, 136.63},
+	{"Fukui", "福井", 36.07, 136.22},
+	{"Kofu", "甲府", 35.66, 138.57},
+	{"Nagano", "長野", 36.65, 138.18},
+	{"Gifu", "岐阜", 35.42, 136.76},
+	{"Shizuoka", "静岡", 34.98, 138.38},
+	{"Nagoya", "名古屋", 35.18, 136.91},
+	{"Tsu", "津", 34.73, 136.51},
+	{"Otsu", "大津", 35.00, 135.87},
+	{"Kyoto", "京都", 35.02, 135.76},
+	{"Osaka", "大阪", 34.69, 135.50},
+	{"Kobe", "神戸", 34.69, 135.18},
+	{"Nara", "奈良", 34.69, 135.83},
+	{"Wakayama", "和歌山", 34.23, 135.17},
+	{"Tottori", "鳥取", 35.50, 134.24},
+	{"Matsue", "松江", 35.47, 133.05},
+	{"Okayama", "岡山", 34.66, 133.93},
+	{"Hiroshima", "広島", 34.40, 132.46},
+	{"Yamaguchi", "山口", 34.19, 131.47},
+	{"Tokushima", "徳島", 34.07, 134.56},
+	{"Takamatsu", "高松", 34.34, 134.04},
+	{"Matsuyama", "松山", 33.84, 132.77},
+	{"Kochi", "高知", 33.56, 133.53},
+	{"Fukuoka", "福岡", 33.59, 130.40},
+	{"Saga", "佐賀", 33.25, 130.30},
+	{"Nagasaki", "長崎", 32.74, 129.87},
+	{"Kumamoto", "熊本", 32.79, 130.74},
+	{"Oita", "大分", 33.24, 131.61},
+	{"Miyazaki", "宮崎", 31.91, 131.42},
+	{"Kagoshima", "鹿児島", 31.56, 130.56},
+	{"Naha", "那覇", 26.21, 127.68},
+}
+
+// LookupGazetteer finds a place of the bundled gazetteer by its English or Japanese name.
+func LookupGazetteer(query string) (layout.ResolvedLocation, bool) {
+	name := strings.ToLower(strings.TrimSpace(query))
+	name = strings.TrimSuffix(strings.TrimSuffix(name, " city"), "市")
+	for _, entry := range gazetteer {
+		if name == strings.ToLower(entry.Name) || name == entry.NameJP {
+			return layout.ResolvedLocation{
+				Name:      entry.Name,
+				Latitude:  entry.Latitude,
+				Longitude: entry.Longitude,
+				Timezone:  "Asia/Tokyo",
+			}, true
+		}
+	}
+	return layout.ResolvedLocation{}, false
+}
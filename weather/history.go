@@ -0,0 +1,476 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JST is the time zone AMeDAS observations are published in.
+var JST = time.FixedZone("JST", 9*60*60)
+
+// amedasCodeRegex matches AMeDAS station codes.
+var amedasCodeRegex = regexp.MustCompile(`^\d{5}$`)
+
+// ValidAmedasCode reports whether the code is an AMeDAS station code, which makes it safe to use in a file path.
+func ValidAmedasCode(amedas_code string) bool {
+	return amedasCodeRegex.MatchString(amedas_code)
+}
+
+// WeatherHistoryCheckQuery checks and validates query parameters for weather history widget requests.
+func WeatherHistoryCheckQuery(c *gin.Context) (layout.WidgetSize, string, string, string, error) {
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	amedas_code := c.Query("location_histdata")
+	rangeName := c.DefaultQuery("range", "7d")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto weatherhistory_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.WeatherHistoryWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto weatherhistory_checkquery_finish
+	}
+
+	if location_name == "" || amedas_code == "" {
+		err = fmt.Errorf("please provide location information")
+		goto weatherhistory_checkquery_finish
+	}
+	if !ValidAmedasCode(amedas_code) {
+		err = fmt.Errorf("please provide a valid amedas location code")
+		goto weatherhistory_checkquery_finish
+	}
+
+	if _, err = GetHistoryRange(rangeName); err != nil {
+		goto weatherhistory_checkquery_finish
+	}
+
+weatherhistory_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, amedas_code, rangeName, err
+}
+
+// Observation represents a single AMeDAS observation with its absolute time. Values not observed are nil.
+type Observation struct {
+	Time             time.Time `json:"time"`
+	Temp             *float64  `json:"temp"`
+	Humidity         *float64  `json:"humidity"`
+	Weather          *int      `json:"weather"`
+	Precipitation10m *float64  `json:"precipitation10m"`
+	Wind             *float64  `json:"wind"`
+	WindDirection    *int      `json:"windDirection"`
+	NormalPressure   *float64  `json:"normalPressure"`
+}
+
+// OBSERVATION_FIELDS are the observation fields that can be aggregated.
+var OBSERVATION_FIELDS = []string{"temp", "humidity", "precipitation10m", "wind", "normalPressure"}
+
+// Value returns the value of the given observation field, or false when it was not observed.
+func (o Observation) Value(field string) (float64, bool) {
+	var value *float64
+	switch field {
+	case "temp":
+		value = o.Temp
+	case "humidity":
+		value = o.Humidity
+	case "precipitation10m":
+		value = o.Precipitation10m
+	case "wind":
+		value = o.Wind
+	case "normalPressure":
+		value = o.NormalPressure
+	}
+	if value == nil {
+		return 0, false
+	}
+	return *value, true
+}
+
+// ParseObservations parses raw historical weather data into observations keyed by absolute time.
+func ParseObservations(rawWeatherData RawHistoricalDataMap) ([]Observation, error) {
+	var observations []Observation
+
+	for timestamp, data := range rawWeatherData {
+		t, err := time.ParseInLocation("20060102150405", timestamp, JST)
+		if err != nil {
+			return nil, fmt.Errorf("invalid observation timestamp \"%s\"", timestamp)
+		}
+
+		observations = append(observations, Observation{
+			Time:             t,
+			Temp:             data.Temp.Ptr(),
+			Humidity:         data.Humidity.Ptr(),
+			Weather:          data.Weather.IntPtr(),
+			Precipitation10m: data.Precipitation10m.Ptr(),
+			Wind:             data.Wind.Ptr(),
+			WindDirection:    data.WindDirection.IntPtr(),
+			NormalPressure:   data.NormalPressure.Ptr(),
+		})
+	}
+	slices.SortFunc(observations, func(a Observation, b Observation) int {
+		return a.Time.Compare(b.Time)
+	})
+	return observations, nil
+}
+
+// HISTORY_CACHE_DAYS is how many days before today the store keeps in memory, covering the longest history range.
+const HISTORY_CACHE_DAYS = 31
+
+// historyDay holds the observations of a station on a day, as cached by the store.
+type historyDay struct {
+	day          time.Time
+	observations []Observation
+}
+
+// HistoryStore is a local time-series store of AMeDAS observations.
+// Observations are kept as one JSON file per station and day under its directory,
+// and the days of the served ranges are cached in memory.
+type HistoryStore struct {
+	dir  string
+	mu   sync.Mutex
+	days map[string]historyDay
+}
+
+// NewHistoryStore creates a history store persisting its data under dir.
+func NewHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{
+		dir:  dir,
+		days: map[string]historyDay{},
+	}
+}
+
+// cacheable reports whether the day is recent enough to be cached in memory.
+func cacheable(day time.Time) bool {
+	return day.After(time.Now().AddDate(0, 0, -HISTORY_CACHE_DAYS-1))
+}
+
+// cache keeps the observations of the day in memory if it is recent enough, evicting the days that are not anymore.
+// The caller must hold s.mu.
+func (s *HistoryStore) cache(path string, day time.Time, observations []Observation) {
+	for cached, entry := range s.days {
+		if !cacheable(entry.day) {
+			delete(s.days, cached)
+		}
+	}
+	if cacheable(day) {
+		s.days[path] = historyDay{day: day, observations: observations}
+	}
+}
+
+// dayPath returns the file path holding the observations of the station on the given day.
+func (s *HistoryStore) dayPath(amedas_code string, day time.Time) (string, error) {
+	if !ValidAmedasCode(amedas_code) {
+		return "", fmt.Errorf("invalid amedas location code \"%s\"", amedas_code)
+	}
+	return filepath.Join(s.dir, amedas_code, day.In(JST).Format("20060102")+".json"), nil
+}
+
+// loadDay returns the observations of the station on the given day. The caller must hold s.mu.
+// Only the days stored on disk are cached, so that unknown stations do not grow the cache.
+func (s *HistoryStore) loadDay(amedas_code string, day time.Time) ([]Observation, error) {
+	path, err := s.dayPath(amedas_code, day)
+	if err != nil {
+		return nil, err
+	}
+	if entry, ok := s.days[path]; ok {
+		return entry.observations, nil
+	}
+
+	var observations []Observation
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return observations, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read history file %s: %v", path, err)
+	}
+	if err = json.Unmarshal(data, &observations); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal history file %s: %v", path, err)
+	}
+	s.cache(path, day, observations)
+	return observations, nil
+}
+
+// Add merges observations of the station into the store, replacing ones with the same time.
+func (s *HistoryStore) Add(amedas_code string, observations []Observation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !ValidAmedasCode(amedas_code) {
+		return fmt.Errorf("invalid amedas location code \"%s\"", amedas_code)
+	}
+
+	byDay := map[string][]Observation{}
+	for _, observation := range observations {
+		day := observation.Time.In(JST).Format("20060102")
+		byDay[day] = append(byDay[day], observation)
+	}
+
+	for _, added := range byDay {
+		existing, err := s.loadDay(amedas_code, added[0].Time)
+		if err != nil {
+			return err
+		}
+
+		merged := slices.Clone(existing)
+		for _, observation := range added {
+			i, found := slices.BinarySearchFunc(merged, observation.Time, func(o Observation, t time.Time) int {
+				return o.Time.Compare(t)
+			})
+			if found {
+				merged[i] = observation
+			} else {
+				merged = slices.Insert(merged, i, observation)
+			}
+		}
+
+		path, _ := s.dayPath(amedas_code, added[0].Time)
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history file %s: %v", path, err)
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create history directory for %s: %v", amedas_code, err)
+		}
+		if err = os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write history file %s: %v", path, err)
+		}
+		s.cache(path, added[0].Time, merged)
+	}
+	return nil
+}
+
+// Range returns the observations of the station in [from, to), sorted by time.
+func (s *HistoryStore) Range(amedas_code string, from, to time.Time) ([]Observation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Observation
+	day := time.Date(from.In(JST).Year(), from.In(JST).Month(), from.In(JST).Day(), 0, 0, 0, 0, JST)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		observations, err := s.loadDay(amedas_code, day)
+		if err != nil {
+			return nil, err
+		}
+		for _, observation := range observations {
+			if !observation.Time.Before(from) && observation.Time.Before(to) {
+				result = append(result, observation)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Count returns the number of stored observations of the station in [from, to).
+func (s *HistoryStore) Count(amedas_code string, from, to time.Time) (int, error) {
+	observations, err := s.Range(amedas_code, from, to)
+	return len(observations), err
+}
+
+// AggregatedPoint represents the aggregation of observations within one bucket.
+type AggregatedPoint struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Mean  float64   `json:"mean"`
+	Count int       `json:"count"`
+}
+
+// AggregateObservations aggregates a field of the observations into nBucket buckets starting at from.
+// Observations missing the field are skipped, and buckets without observations are returned with a zero count.
+func AggregateObservations(observations []Observation, field string, from time.Time, bucket time.Duration, nBucket int) ([]AggregatedPoint, error) {
+	if !slices.Contains(OBSERVATION_FIELDS, field) {
+		return nil, fmt.Errorf("unknown observation field \"%s\"", field)
+	}
+
+	points := make([]AggregatedPoint, nBucket)
+	sums := make([]float64, nBucket)
+	for i := range points {
+		points[i] = AggregatedPoint{
+			Time: from.Add(time.Duration(i) * bucket),
+			Min:  math.Inf(1),
+			Max:  math.Inf(-1),
+		}
+	}
+
+	for _, observation := range observations {
+		value, ok := observation.Value(field)
+		i := int(observation.Time.Sub(from) / bucket)
+		if !ok || observation.Time.Before(from) || i >= nBucket {
+			continue
+		}
+		points[i].Min = min(points[i].Min, value)
+		points[i].Max = max(points[i].Max, value)
+		sums[i] += value
+		points[i].Count++
+	}
+
+	for i := range points {
+		if points[i].Count == 0 {
+			points[i].Min = 0
+			points[i].Max = 0
+			continue
+		}
+		points[i].Mean = sums[i] / float64(points[i].Count)
+	}
+	return points, nil
+}
+
+// HistoryRange describes the span of a history series and the width of its buckets.
+type HistoryRange struct {
+	Span   time.Duration
+	Bucket time.Duration
+}
+
+// Supported history ranges.
+var historyRanges = map[string]HistoryRange{
+	"24h": {Span: 24 * time.Hour, Bucket: time.Hour},
+	"7d":  {Span: 7 * 24 * time.Hour, Bucket: 6 * time.Hour},
+	"30d": {Span: 30 * 24 * time.Hour, Bucket: 24 * time.Hour},
+}
+
+// GetHistoryRange returns the history range with the given name.
+func GetHistoryRange(name string) (HistoryRange, error) {
+	historyRange, ok := historyRanges[name]
+	if !ok {
+		return historyRange, fmt.Errorf("invalid range \"%s\" (supported: 24h, 7d, 30d)", name)
+	}
+	return historyRange, nil
+}
+
+// alignToBucket returns the start of the bucket containing t, counting buckets from midnight JST.
+func alignToBucket(t time.Time, bucket time.Duration) time.Time {
+	t = t.In(JST)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, JST)
+	if bucket >= 24*time.Hour {
+		return midnight
+	}
+	return midnight.Add(t.Sub(midnight).Truncate(bucket))
+}
+
+// HistorySeries represents an aggregated series of observations for one station.
+type HistorySeries struct {
+	AmedasCode string            `json:"amedas_code"`
+	Range      string            `json:"range"`
+	Field      string            `json:"field"`
+	Bucket     string            `json:"bucket"`
+	Points     []AggregatedPoint `json:"points"`
+}
+
+// GetHistorySeries aggregates the stored observations of the station over the named range ending at now.
+func GetHistorySeries(store *HistoryStore, amedas_code, rangeName, field string, now time.Time) (HistorySeries, error) {
+	var series HistorySeries
+	var observations []Observation
+	var from, to time.Time
+	var nBucket int
+
+	historyRange, err := GetHistoryRange(rangeName)
+	if err != nil {
+		goto weather_gethistoryseries_finish
+	}
+
+	nBucket = int(historyRange.Span / historyRange.Bucket)
+	to = alignToBucket(now, historyRange.Bucket).Add(historyRange.Bucket)
+	from = to.Add(-time.Duration(nBucket) * historyRange.Bucket)
+
+	observations, err = store.Range(amedas_code, from, to)
+	if err != nil {
+		goto weather_gethistoryseries_finish
+	}
+
+	series = HistorySeries{
+		AmedasCode: amedas_code,
+		Range:      rangeName,
+		Field:      field,
+		Bucket:     historyRange.Bucket.String(),
+	}
+	series.Points, err = AggregateObservations(observations, field, from, historyRange.Bucket, nBucket)
+
+weather_gethistoryseries_finish:
+	return series, err
+}
+
+// GetDaySeries aggregates the stored observations of the station on the given day into hourly points.
+func GetDaySeries(store *HistoryStore, amedas_code, field string, day time.Time) ([]AggregatedPoint, error) {
+	day = day.In(JST)
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, JST)
+	to := from.AddDate(0, 0, 1)
+
+	observations, err := store.Range(amedas_code, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return AggregateObservations(observations, field, from, time.Hour, 24)
+}
+
+// plotXY scales the i-th of n values into SVG coordinates of the given size.
+func plotXY(i, n int, value, lower, upper, width, height float64) string {
+	if upper <= lower {
+		upper = lower + 1
+	}
+	x := width * float64(i) / float64(max(n-1, 1))
+	y := height - height*(value-lower)/(upper-lower)
+	return fmt.Sprintf("%.2f,%.2f", x, y)
+}
+
+// PlotPoints scales the selected value of the points into an SVG point list of the given size.
+// Empty points are skipped. Lower and upper give the vertical range of the plot.
+func PlotPoints(points []AggregatedPoint, value func(AggregatedPoint) float64, lower, upper, width, height float64) string {
+	var coords []string
+	for i, point := range points {
+		if point.Count > 0 {
+			coords = append(coords, plotXY(i, len(points), value(point), lower, upper, width, height))
+		}
+	}
+	return strings.Join(coords, " ")
+}
+
+// PlotBand scales the min/max range of the points into an SVG polygon point list of the given size.
+func PlotBand(points []AggregatedPoint, lower, upper, width, height float64) string {
+	var upperEdge, lowerEdge []string
+	for i, point := range points {
+		if point.Count > 0 {
+			upperEdge = append(upperEdge, plotXY(i, len(points), point.Max, lower, upper, width, height))
+			lowerEdge = append(lowerEdge, plotXY(i, len(points), point.Min, lower, upper, width, height))
+		}
+	}
+	slices.Reverse(lowerEdge)
+	return strings.Join(append(upperEdge, lowerEdge...), " ")
+}
+
+// MeanOf selects the mean of an aggregated point.
+func MeanOf(p AggregatedPoint) float64 {
+	return p.Mean
+}
+
+// PointsBounds returns the lowest minimum and the highest maximum of the non-empty points.
+func PointsBounds(pointsCol ...[]AggregatedPoint) (float64, float64) {
+	lower, upper := math.Inf(1), math.Inf(-1)
+	for _, points := range pointsCol {
+		for _, point := range points {
+			if point.Count > 0 {
+				lower = min(lower, point.Min)
+				upper = max(upper, point.Max)
+			}
+		}
+	}
+	if math.IsInf(lower, 0) || math.IsInf(upper, 0) {
+		return 0, 0
+	}
+	return math.Floor(lower), math.Ceil(upper)
+}
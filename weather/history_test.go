@@ -0,0 +1,72 @@
+package weather
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseObservationsSkipsMissingValues(t *testing.T) {
+	var raw RawHistoricalDataMap
+	err := json.Unmarshal([]byte(`{
+		"20240801120000": {"temp": [30.5, 0], "humidity": [null, 0], "wind": [2.0, 5]},
+		"20240801121000": {"temp": [31.0, 1], "humidity": [60, 0]},
+		"20240801122000": {"temp": [null, 6]}
+	}`), &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observations, err := ParseObservations(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 3 {
+		t.Fatalf("got %d observations, want 3", len(observations))
+	}
+	if _, ok := observations[0].Value("humidity"); ok {
+		t.Errorf("a null humidity was parsed as observed")
+	}
+	if _, ok := observations[0].Value("wind"); ok {
+		t.Errorf("a wind flagged as not normal was parsed as observed")
+	}
+	if _, ok := observations[1].Value("precipitation10m"); ok {
+		t.Errorf("an absent precipitation was parsed as observed")
+	}
+
+	from := observations[0].Time
+	points, err := AggregateObservations(observations, "temp", from, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points[0].Count != 2 || points[0].Min != 30.5 || points[0].Mean != 30.75 {
+		t.Errorf("aggregated temp to %+v, want 2 observations from 30.5 with a mean of 30.75", points[0])
+	}
+	points, err = AggregateObservations(observations, "humidity", from, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points[0].Count != 1 || points[0].Min != 60 {
+		t.Errorf("aggregated humidity to %+v, want 1 observation of 60", points[0])
+	}
+}
+
+func TestHistoryStoreAmedasCodes(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	now := time.Now()
+	for _, amedas_code := range []string{"../../x", "8218", "82182/..", ""} {
+		if _, err := store.Range(amedas_code, now.Add(-time.Hour), now); err == nil {
+			t.Errorf("Range accepted the amedas location code %q", amedas_code)
+		}
+		if err := store.Add(amedas_code, []Observation{{Time: now}}); err == nil {
+			t.Errorf("Add accepted the amedas location code %q", amedas_code)
+		}
+	}
+
+	// Days without a file are not cached.
+	if _, err := store.Range("82182", now.AddDate(0, 0, -2), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.days) != 0 {
+		t.Errorf("cached %d days without observations", len(store.days))
+	}
+}
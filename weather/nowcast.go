@@ -0,0 +1,164 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NOWCAST_STEPS is the number of 15-minute steps requested for the rain nowcast (2 hours).
+const NOWCAST_STEPS = 8
+
+// RAIN_THRESHOLD_MM_H is the precipitation intensity from which a step counts as rainy.
+const RAIN_THRESHOLD_MM_H = 0.5
+
+// HEAVY_RAIN_THRESHOLD_MM_H is the precipitation intensity from which rain raises an alert.
+const HEAVY_RAIN_THRESHOLD_MM_H = 20.0
+
+// HEAVY_RAIN_ALERT_MINS is how far ahead heavy rain raises an alert.
+const HEAVY_RAIN_ALERT_MINS = 60
+
+// RainNowcast represents the rain outlook for the next hours.
+type RainNowcast struct {
+	Raining      bool    `json:"raining"`
+	StartsInMins int     `json:"starts_in_mins"`
+	StopsInMins  int     `json:"stops_in_mins"`
+	Intensity    float64 `json:"intensity"`
+	Icon         string  `json:"icon"`
+	Message      string  `json:"message"`
+	Alert        string  `json:"alert"`
+}
+
+// ParseRainNowcast summarizes the 15-minutely precipitation forecast following now.
+func ParseRainNowcast(data RawForecastData, now time.Time) (RainNowcast, error) {
+	var nowcast RainNowcast
+	var intensities []float64
+	var startMins []int
+	var end time.Time
+
+	location, err := time.LoadLocation(data.Timezone)
+	if err != nil {
+		return nowcast, fmt.Errorf("invalid time zone \"%s\"", data.Timezone)
+	}
+
+	for i, datetimeStr := range data.Minutely15.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", datetimeStr, location)
+		if err != nil {
+			return nowcast, fmt.Errorf("invalid nowcast time \"%s\"", datetimeStr)
+		}
+		// Each value is the precipitation of the preceding 15 minutes.
+		if !t.After(now) || i >= len(data.Minutely15.Precipitation) {
+			continue
+		}
+		intensities = append(intensities, data.Minutely15.Precipitation[i]*4)
+		startMins = append(startMins, max(int(t.Add(-15*time.Minute).Sub(now).Minutes()), 0))
+		end = t
+	}
+	if len(intensities) == 0 {
+		return nowcast, fmt.Errorf("no forthcoming nowcast found")
+	}
+
+	// The nowcast covers from now to the end of its last step, the first one being already under way.
+	horizon := formatHorizon(int(end.Sub(now).Minutes()))
+	nowcast.StartsInMins = -1
+	nowcast.StopsInMins = -1
+	nowcast.Raining = intensities[0] >= RAIN_THRESHOLD_MM_H
+	for i, intensity := range intensities {
+		rainy := intensity >= RAIN_THRESHOLD_MM_H
+		if rainy && nowcast.StartsInMins < 0 && !nowcast.Raining {
+			nowcast.StartsInMins = startMins[i]
+		}
+		if !rainy && nowcast.Raining && nowcast.StopsInMins < 0 {
+			nowcast.StopsInMins = startMins[i]
+		}
+		if rainy {
+			nowcast.Intensity = max(nowcast.Intensity, intensity)
+		}
+		if intensity >= HEAVY_RAIN_THRESHOLD_MM_H && startMins[i] <= HEAVY_RAIN_ALERT_MINS && nowcast.Alert == "" {
+			nowcast.Alert = fmt.Sprintf("Heavy rain (%.0f mm/h) expected within %d min", intensity, max(startMins[i], 15))
+		}
+	}
+
+	switch {
+	case nowcast.Raining && nowcast.StopsInMins >= 0:
+		nowcast.Icon = "rainy"
+		nowcast.Message = fmt.Sprintf("Rain stopping in ~%d min, %s", roundToFive(nowcast.StopsInMins), formatIntensity(nowcast.Intensity))
+	case nowcast.Raining:
+		nowcast.Icon = "rainy"
+		nowcast.Message = fmt.Sprintf("Rain for the next %s, %s", horizon, formatIntensity(nowcast.Intensity))
+	case nowcast.StartsInMins >= 0:
+		nowcast.Icon = "umbrella"
+		nowcast.Message = fmt.Sprintf("Rain starting in ~%d min, %s", roundToFive(max(nowcast.StartsInMins, 5)), formatIntensity(nowcast.Intensity))
+	default:
+		nowcast.Icon = "wb_sunny"
+		nowcast.Message = fmt.Sprintf("Dry for the next %s", horizon)
+	}
+	return nowcast, nil
+}
+
+// roundToFive rounds minutes to the nearest multiple of five.
+func roundToFive(mins int) int {
+	return (mins + 2) / 5 * 5
+}
+
+// formatHorizon formats a span of minutes for display, in whole hours from an hour on.
+func formatHorizon(mins int) string {
+	switch {
+	case mins < 60:
+		return fmt.Sprintf("%d min", mins)
+	case mins < 120:
+		return "hour"
+	}
+	return fmt.Sprintf("%d hours", mins/60)
+}
+
+// formatIntensity formats a precipitation intensity for display.
+func formatIntensity(intensity float64) string {
+	if intensity < 1 {
+		return fmt.Sprintf("%.1f mm/h", intensity)
+	}
+	return fmt.Sprintf("%.0f mm/h", intensity)
+}
+
+// RainAlertCheckQuery checks and validates query parameters for rain alert requests.
+func RainAlertCheckQuery(c *gin.Context) (layout.WidgetSize, string, float64, float64, error) {
+	var latitude, longitude float64
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	latitude_str := c.Query("location_latitude")
+	longitude_str := c.Query("location_longitude")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto rainalert_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.RainAlertWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto rainalert_checkquery_finish
+	}
+
+	if location_name == "" || latitude_str == "" || longitude_str == "" {
+		err = fmt.Errorf("please provide location information")
+		goto rainalert_checkquery_finish
+	}
+	latitude, err = strconv.ParseFloat(latitude_str, 64)
+	if err != nil {
+		err = fmt.Errorf("please provide valid latitude information")
+		goto rainalert_checkquery_finish
+	}
+	longitude, err = strconv.ParseFloat(longitude_str, 64)
+	if err != nil {
+		err = fmt.Errorf("please provide valid longitude information")
+		goto rainalert_checkquery_finish
+	}
+
+rainalert_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, latitude, longitude, err
+}
@@ -0,0 +1,37 @@
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRainNowcastHorizon(t *testing.T) {
+	tests := []struct {
+		steps   int
+		now     string
+		message string
+	}{
+		{steps: 8, now: "2024-08-01T12:00", message: "Dry for the next 2 hours"},
+		{steps: 8, now: "2024-08-01T12:05", message: "Dry for the next hour"},
+		{steps: 5, now: "2024-08-01T12:00", message: "Dry for the next hour"},
+		{steps: 3, now: "2024-08-01T12:10", message: "Dry for the next 35 min"},
+	}
+	for _, tt := range tests {
+		// The first step ends at 12:15, the data of Open-Meteo starting at the quarter under way.
+		var data RawForecastData
+		data.Timezone = "Asia/Tokyo"
+		start := time.Date(2024, 8, 1, 12, 15, 0, 0, JST)
+		for i := 0; i < tt.steps; i++ {
+			data.Minutely15.Time = append(data.Minutely15.Time, start.Add(time.Duration(i)*15*time.Minute).Format("2006-01-02T15:04"))
+			data.Minutely15.Precipitation = append(data.Minutely15.Precipitation, 0)
+		}
+		now, _ := time.ParseInLocation("2006-01-02T15:04", tt.now, JST)
+		nowcast, err := ParseRainNowcast(data, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nowcast.Message != tt.message {
+			t.Errorf("%d steps at %s: got %q, want %q", tt.steps, tt.now, nowcast.Message, tt.message)
+		}
+	}
+}
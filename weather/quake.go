@@ -0,0 +1,429 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kken7231/screensaver/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QUAKE_COLLECT_INTERVAL is the interval between two fetches of the JMA earthquake list.
+const QUAKE_COLLECT_INTERVAL = time.Minute
+
+// QUAKE_LIST_SIZE is the number of recent earthquakes kept in the feed.
+const QUAKE_LIST_SIZE = 20
+
+// QUAKE_OVERLAY_DURATION is how long a strong earthquake keeps the overlay raised.
+const QUAKE_OVERLAY_DURATION = 30 * time.Minute
+
+// DEFAULT_QUAKE_INTENSITY is the seismic intensity raising the overlay unless configured.
+const DEFAULT_QUAKE_INTENSITY = "4"
+
+// Japanese names of the prefectures, indexed by JIS prefecture code minus one.
+var prefectureNames = []string{
+	"北海道", "青森県", "岩手県", "宮城県", "秋田県", "山形県", "福島県", "茨城県", "栃木県", "群馬県",
+	"埼玉県", "千葉県", "東京都", "神奈川県", "新潟県", "富山県", "石川県", "福井県", "山梨県", "長野県",
+	"岐阜県", "静岡県", "愛知県", "三重県", "滋賀県", "京都府", "大阪府", "兵庫県", "奈良県", "和歌山県",
+	"鳥取県", "島根県", "岡山県", "広島県", "山口県", "徳島県", "香川県", "愛媛県", "高知県", "福岡県",
+	"佐賀県", "長崎県", "熊本県", "大分県", "宮崎県", "鹿児島県", "沖縄県",
+}
+
+// IntensityRank returns the rank of a JMA seismic intensity such as "5-", from 1 for "1" to 9 for "7", or 0 if unknown.
+func IntensityRank(intensity string) int {
+	return slices.Index(layout.QUAKE_INTENSITIES, intensity) + 1
+}
+
+// FormatIntensity formats a JMA seismic intensity for display, e.g. "5-" as "5弱".
+func FormatIntensity(intensity string) string {
+	if intensity == "" {
+		return "-"
+	}
+	intensity = strings.Replace(intensity, "-", "弱", 1)
+	return strings.Replace(intensity, "+", "強", 1)
+}
+
+// PrefectureName returns the name of a prefecture from its JIS code.
+func PrefectureName(code string) string {
+	index, err := strconv.Atoi(code)
+	if err != nil || index < 1 || index > len(prefectureNames) {
+		return code
+	}
+	return prefectureNames[index-1]
+}
+
+// RawQuakeCity represents the maximum intensity of a city in the JMA earthquake list.
+type RawQuakeCity struct {
+	Code         string `json:"code"`
+	MaxIntensity string `json:"maxi"`
+}
+
+// RawQuakeArea represents the maximum intensity of a prefecture in the JMA earthquake list.
+type RawQuakeArea struct {
+	Code         string         `json:"code"`
+	MaxIntensity string         `json:"maxi"`
+	Cities       []RawQuakeCity `json:"city"`
+}
+
+// RawQuakeEntry represents a report in the JMA earthquake list.
+type RawQuakeEntry struct {
+	EventID      string         `json:"eid"`
+	ReportTime   string         `json:"rdt"`
+	Title        string         `json:"ttl"`
+	OriginTime   string         `json:"at"`
+	Epicenter    string         `json:"anm"`
+	EpicenterEN  string         `json:"en_anm"`
+	Coordinates  string         `json:"cod"`
+	Magnitude    string         `json:"mag"`
+	MaxIntensity string         `json:"maxi"`
+	Areas        []RawQuakeArea `json:"int"`
+}
+
+// QuakeCity represents the maximum intensity observed in a city.
+type QuakeCity struct {
+	Code         string `json:"code"`
+	MaxIntensity string `json:"max_intensity"`
+}
+
+// QuakeArea represents the maximum intensity observed in a prefecture.
+type QuakeArea struct {
+	Code         string      `json:"code"`
+	Name         string      `json:"name"`
+	MaxIntensity string      `json:"max_intensity"`
+	Cities       []QuakeCity `json:"cities"`
+}
+
+// QuakeEvent represents an earthquake merged from its JMA reports.
+type QuakeEvent struct {
+	EventID      string      `json:"event_id"`
+	Time         time.Time   `json:"time"`
+	Epicenter    string      `json:"epicenter"`
+	EpicenterEN  string      `json:"epicenter_en"`
+	Latitude     float64     `json:"latitude"`
+	Longitude    float64     `json:"longitude"`
+	DepthKm      int         `json:"depth_km"`
+	Magnitude    string      `json:"magnitude"`
+	MaxIntensity string      `json:"max_intensity"`
+	Areas        []QuakeArea `json:"areas"`
+}
+
+// coordinatesRegex matches ISO 6709 coordinates of the JMA earthquake list such as "+37.5+137.2-10000/".
+var coordinatesRegex = regexp.MustCompile(`^([+-][\d.]+)([+-][\d.]+)([+-]\d+)?/?$`)
+
+// FetchQuakeList fetches the list of recent earthquake reports from JMA.
+func FetchQuakeList(ctx context.Context, client *http.Client) ([]RawQuakeEntry, error) {
+	var result []RawQuakeEntry
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var body []byte
+
+	url := "https://www.jma.go.jp/bosai/quake/data/list.json"
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create a request for earthquake data: %v", err)
+		goto weather_fetchquakelist_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch earthquake data (url: %s): %v", url, err)
+		goto weather_fetchquakelist_finish
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch earthquake data (url: %s): %s", url, resp.Status)
+		goto weather_fetchquakelist_finish
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read earthquake data body (url: %s)", url)
+		goto weather_fetchquakelist_finish
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		err = fmt.Errorf("failed to unmarshal earthquake data json (url: %s)", url)
+		goto weather_fetchquakelist_finish
+	}
+
+weather_fetchquakelist_finish:
+	return result, err
+}
+
+// ParseQuakeList merges the reports of the JMA earthquake list into events, newest first.
+// The list is ordered newest first, so the latest report of an event takes precedence
+// and older reports only fill in what it lacks (e.g. a seismic intensity flash has no epicenter).
+func ParseQuakeList(entries []RawQuakeEntry, limit int) []QuakeEvent {
+	var events []QuakeEvent
+	indices := map[string]int{}
+
+	for _, entry := range entries {
+		if entry.EventID == "" {
+			continue
+		}
+		index, ok := indices[entry.EventID]
+		if !ok {
+			if len(events) >= limit {
+				continue
+			}
+			index = len(events)
+			indices[entry.EventID] = index
+			events = append(events, QuakeEvent{EventID: entry.EventID})
+		}
+		event := &events[index]
+
+		if event.Time.IsZero() {
+			originTime := entry.OriginTime
+			if originTime == "" {
+				originTime = entry.ReportTime
+			}
+			if t, err := time.Parse(time.RFC3339, originTime); err == nil {
+				event.Time = t.In(JST)
+			}
+		}
+		if event.Epicenter == "" && entry.Epicenter != "" {
+			event.Epicenter = entry.Epicenter
+			event.EpicenterEN = entry.EpicenterEN
+		}
+		if event.Magnitude == "" && entry.Magnitude != "" {
+			event.Magnitude = entry.Magnitude
+		}
+		if event.Latitude == 0 && event.Longitude == 0 {
+			if matches := coordinatesRegex.FindStringSubmatch(entry.Coordinates); matches != nil {
+				event.Latitude, _ = strconv.ParseFloat(matches[1], 64)
+				event.Longitude, _ = strconv.ParseFloat(matches[2], 64)
+				if depth, err := strconv.Atoi(matches[3]); err == nil {
+					event.DepthKm = -depth / 1000
+				}
+			}
+		}
+		if event.MaxIntensity == "" && entry.MaxIntensity != "" {
+			event.MaxIntensity = entry.MaxIntensity
+		}
+		if len(event.Areas) == 0 {
+			for _, area := range entry.Areas {
+				quakeArea := QuakeArea{
+					Code:         area.Code,
+					Name:         PrefectureName(area.Code),
+					MaxIntensity: area.MaxIntensity,
+				}
+				for _, city := range area.Cities {
+					quakeArea.Cities = append(quakeArea.Cities, QuakeCity{Code: city.Code, MaxIntensity: city.MaxIntensity})
+				}
+				event.Areas = append(event.Areas, quakeArea)
+			}
+		}
+	}
+	return events
+}
+
+// IntensityIn returns the maximum intensity of the event in the area, given as a
+// prefecture code ("13") or a city code ("1310100"). It is empty if not observed.
+func (e QuakeEvent) IntensityIn(area_code string) string {
+	for _, area := range e.Areas {
+		if len(area_code) <= 2 {
+			if area.Code == area_code {
+				return area.MaxIntensity
+			}
+			continue
+		}
+		for _, city := range area.Cities {
+			if city.Code == area_code {
+				return city.MaxIntensity
+			}
+		}
+	}
+	return ""
+}
+
+// QuakeFeed holds the recent earthquakes fetched in the background.
+type QuakeFeed struct {
+	mu      sync.RWMutex
+	events  []QuakeEvent
+	updated time.Time
+}
+
+// NewQuakeFeed creates an empty earthquake feed.
+func NewQuakeFeed() *QuakeFeed {
+	return &QuakeFeed{}
+}
+
+// Update replaces the events of the feed.
+func (f *QuakeFeed) Update(events []QuakeEvent, updated time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = events
+	f.updated = updated
+}
+
+// Events returns the recent events of the feed, newest first, and when they were fetched.
+func (f *QuakeFeed) Events() ([]QuakeEvent, time.Time) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return slices.Clone(f.events), f.updated
+}
+
+// CollectQuakes fetches the JMA earthquake list into the feed.
+func CollectQuakes(ctx context.Context, client *http.Client, feed *QuakeFeed, now time.Time) {
+	entries, err := FetchQuakeList(ctx, client)
+	if err != nil {
+		log.Printf("Failed to collect earthquakes: %v", err)
+		return
+	}
+	feed.Update(ParseQuakeList(entries, QUAKE_LIST_SIZE), now)
+}
+
+// StartQuakeCollector starts fetching the JMA earthquake list into the feed in the background.
+func StartQuakeCollector(ctx context.Context, client *http.Client, feed *QuakeFeed, interval time.Duration) {
+	go func() {
+		CollectQuakes(ctx, client, feed, time.Now())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				CollectQuakes(ctx, client, feed, now)
+			}
+		}
+	}()
+}
+
+// QuakeRow represents an earthquake in the list of the quake widget.
+type QuakeRow struct {
+	Time         string `json:"time"`
+	Epicenter    string `json:"epicenter"`
+	Magnitude    string `json:"magnitude"`
+	MaxIntensity string `json:"max_intensity"`
+	Level        string `json:"level"`
+}
+
+// QuakeOverlay represents the overlay raised by a strong earthquake in a watched area.
+type QuakeOverlay struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// QuakeData represents the recent earthquakes for display.
+type QuakeData struct {
+	Rows    []QuakeRow    `json:"rows"`
+	Latest  string        `json:"latest"`
+	Updated string        `json:"updated"`
+	Overlay *QuakeOverlay `json:"overlay"`
+}
+
+// intensityLevel classifies an intensity for color coding.
+func intensityLevel(intensity string) string {
+	switch rank := IntensityRank(intensity); {
+	case rank >= IntensityRank("5-"):
+		return "strong"
+	case rank >= IntensityRank("3"):
+		return "moderate"
+	}
+	return "weak"
+}
+
+// ParseQuakeData formats the recent events for display. The overlay is raised by the newest event of the
+// last QUAKE_OVERLAY_DURATION reaching the intensity threshold in one of the watched areas.
+func ParseQuakeData(events []QuakeEvent, updated time.Time, count int, areas []string, threshold string, now time.Time) QuakeData {
+	quakeData := QuakeData{Rows: []QuakeRow{}, Latest: "No recent earthquakes", Updated: "-"}
+	if !updated.IsZero() {
+		quakeData.Updated = updated.In(JST).Format("15:04")
+	}
+
+	for i, event := range events {
+		magnitude := "-"
+		if event.Magnitude != "" {
+			magnitude = "M" + event.Magnitude
+		}
+		epicenter := event.Epicenter
+		if epicenter == "" {
+			epicenter = "調査中"
+		}
+		if i < count {
+			quakeData.Rows = append(quakeData.Rows, QuakeRow{
+				Time:         event.Time.Format("1/2 15:04"),
+				Epicenter:    epicenter,
+				Magnitude:    magnitude,
+				MaxIntensity: FormatIntensity(event.MaxIntensity),
+				Level:        intensityLevel(event.MaxIntensity),
+			})
+		}
+		if i == 0 {
+			quakeData.Latest = fmt.Sprintf("%s %s %s 最大震度%s", event.Time.Format("15:04"), epicenter, magnitude, FormatIntensity(event.MaxIntensity))
+		}
+
+		if quakeData.Overlay != nil || now.Sub(event.Time) > QUAKE_OVERLAY_DURATION {
+			continue
+		}
+		var hits []string
+		for _, area_code := range areas {
+			intensity := event.IntensityIn(area_code)
+			if IntensityRank(intensity) >= IntensityRank(threshold) {
+				name := PrefectureName(area_code)
+				if len(area_code) > 2 {
+					name = PrefectureName(area_code[:2]) + " (" + area_code + ")"
+				}
+				hits = append(hits, fmt.Sprintf("%s 震度%s", name, FormatIntensity(intensity)))
+			}
+		}
+		if len(hits) > 0 {
+			quakeData.Overlay = &QuakeOverlay{
+				ID:      event.EventID,
+				Title:   fmt.Sprintf("地震 %s 最大震度%s", event.Time.Format("15:04"), FormatIntensity(event.MaxIntensity)),
+				Message: fmt.Sprintf("%s %s / %s", epicenter, magnitude, strings.Join(hits, "・")),
+			}
+		}
+	}
+	return quakeData
+}
+
+// QuakeCheckQuery checks and validates query parameters for earthquake requests.
+func QuakeCheckQuery(c *gin.Context) (layout.WidgetSize, []string, string, error) {
+	var areas []string
+	var err error
+
+	size_str := c.Query("size")
+	areas_str := c.Query("quake_areas")
+	threshold := c.DefaultQuery("quake_intensity", DEFAULT_QUAKE_INTENSITY)
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto quake_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.QuakeWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto quake_checkquery_finish
+	}
+
+	if areas_str != "" {
+		if err = json.Unmarshal([]byte(areas_str), &areas); err != nil {
+			err = fmt.Errorf("please provide a valid list of area codes")
+			goto quake_checkquery_finish
+		}
+	}
+	if IntensityRank(threshold) == 0 {
+		err = fmt.Errorf("please provide a valid seismic intensity (1, 2, 3, 4, 5-, 5+, 6-, 6+ or 7)")
+		goto quake_checkquery_finish
+	}
+
+quake_checkquery_finish:
+	return (layout.WidgetSize)(size_str), areas, threshold, err
+}
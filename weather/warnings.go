@@ -0,0 +1,349 @@
+// Package weather provides functionalities for fetching and parsing weather data.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kken7231/screensaver/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WarningLevel represents the severity of a JMA warning.
+type WarningLevel string
+
+// Constants for the severities of JMA warnings.
+const (
+	Advisory         WarningLevel = "advisory"
+	Warning          WarningLevel = "warning"
+	EmergencyWarning WarningLevel = "emergency"
+)
+
+// WarningKind describes a JMA warning code.
+type WarningKind struct {
+	Name   string
+	NameEN string
+	Level  WarningLevel
+}
+
+// Mapping of JMA warning codes to their kinds.
+var warningKinds = map[string]WarningKind{
+	"32": {"暴風雪特別警報", "Blizzard Emergency Warning", EmergencyWarning},
+	"33": {"大雨特別警報", "Heavy Rain Emergency Warning", EmergencyWarning},
+	"35": {"暴風特別警報", "Storm Emergency Warning", EmergencyWarning},
+	"36": {"大雪特別警報", "Heavy Snow Emergency Warning", EmergencyWarning},
+	"37": {"波浪特別警報", "High Wave Emergency Warning", EmergencyWarning},
+	"38": {"高潮特別警報", "Storm Surge Emergency Warning", EmergencyWarning},
+	"02": {"暴風雪警報", "Blizzard Warning", Warning},
+	"03": {"大雨警報", "Heavy Rain Warning", Warning},
+	"04": {"洪水警報", "Flood Warning", Warning},
+	"05": {"暴風警報", "Storm Warning", Warning},
+	"06": {"大雪警報", "Heavy Snow Warning", Warning},
+	"07": {"波浪警報", "High Wave Warning", Warning},
+	"08": {"高潮警報", "Storm Surge Warning", Warning},
+	"10": {"大雨注意報", "Heavy Rain Advisory", Advisory},
+	"12": {"大雪注意報", "Heavy Snow Advisory", Advisory},
+	"13": {"風雪注意報", "Snow and Wind Advisory", Advisory},
+	"14": {"雷注意報", "Thunderstorm Advisory", Advisory},
+	"15": {"強風注意報", "Gale Advisory", Advisory},
+	"16": {"波浪注意報", "High Wave Advisory", Advisory},
+	"17": {"融雪注意報", "Snowmelt Advisory", Advisory},
+	"18": {"洪水注意報", "Flood Advisory", Advisory},
+	"19": {"高潮注意報", "Storm Surge Advisory", Advisory},
+	"20": {"濃霧注意報", "Dense Fog Advisory", Advisory},
+	"21": {"乾燥注意報", "Dry Air Advisory", Advisory},
+	"22": {"なだれ注意報", "Avalanche Advisory", Advisory},
+	"23": {"低温注意報", "Low Temperature Advisory", Advisory},
+	"24": {"霜注意報", "Frost Advisory", Advisory},
+	"25": {"着氷注意報", "Ice Accretion Advisory", Advisory},
+	"26": {"着雪注意報", "Snow Accretion Advisory", Advisory},
+}
+
+// BANNER_WARNING_CODES are the warning codes raising the layout-wide alert banner:
+// every emergency warning plus the heavy rain, flood and storm warnings.
+// Heat stroke alerts (熱中症警戒アラート) have no code here: they are issued jointly with the Ministry of the Environment
+// in a separate feed, not in the warning data of the offices, so they cannot raise the banner.
+var BANNER_WARNING_CODES = []string{"32", "33", "35", "36", "37", "38", "02", "03", "04", "05"}
+
+// Statuses of warnings that are no longer in effect.
+const (
+	WARNING_STATUS_LIFTED = "解除"
+	WARNING_STATUS_NONE   = "発表警報・注意報はなし"
+)
+
+// RawWarningItem represents a warning in the JMA warning data.
+type RawWarningItem struct {
+	Code   string `json:"code"`
+	Status string `json:"status"`
+}
+
+// RawWarningArea represents the warnings of one area in the JMA warning data.
+type RawWarningArea struct {
+	Code     string           `json:"code"`
+	Warnings []RawWarningItem `json:"warnings"`
+}
+
+// RawWarningAreaType represents a class of areas (regions or cities) in the JMA warning data.
+type RawWarningAreaType struct {
+	Areas []RawWarningArea `json:"areas"`
+}
+
+// RawWarningData represents the JMA warning data of a forecast office.
+type RawWarningData struct {
+	ReportDatetime   string               `json:"reportDatetime"`
+	PublishingOffice string               `json:"publishingOffice"`
+	HeadlineText     string               `json:"headlineText"`
+	AreaTypes        []RawWarningAreaType `json:"areaTypes"`
+}
+
+// WarningItem represents a warning in effect for display.
+type WarningItem struct {
+	Code   string       `json:"code"`
+	Name   string       `json:"name"`
+	NameEN string       `json:"name_en"`
+	Level  WarningLevel `json:"level"`
+	Status string       `json:"status"`
+}
+
+// WarningData represents the warnings in effect for an area.
+type WarningData struct {
+	ReportDatetime string        `json:"report_datetime"`
+	Headline       string        `json:"headline"`
+	Summary        string        `json:"summary"`
+	Warnings       []WarningItem `json:"warnings"`
+	Alert          string        `json:"alert"`
+}
+
+// areaCodeRegex matches JMA area codes: 6 digits for regions, 7 digits for cities.
+var areaCodeRegex = regexp.MustCompile(`^\d{6,7}$`)
+
+// officeCodeRegex matches JMA forecast office codes.
+var officeCodeRegex = regexp.MustCompile(`^\d{6}$`)
+
+// AREA_TABLE_URL is the JMA table of areas, from the offices down to the cities.
+const AREA_TABLE_URL = "https://www.jma.go.jp/bosai/common/const/area.json"
+
+// RawAreaEntry represents an area in the JMA area table.
+type RawAreaEntry struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent"`
+}
+
+// RawAreaTable represents the JMA area table, each class of areas keyed by code.
+type RawAreaTable struct {
+	Offices  map[string]RawAreaEntry `json:"offices"`
+	Class10s map[string]RawAreaEntry `json:"class10s"`
+	Class15s map[string]RawAreaEntry `json:"class15s"`
+	Class20s map[string]RawAreaEntry `json:"class20s"`
+}
+
+// areaTableCache holds the JMA area table once fetched.
+var (
+	areaTableCache      *RawAreaTable
+	areaTableCacheMutex sync.Mutex
+)
+
+// FetchAreaTable fetches the JMA area table, which is cached once fetched successfully.
+func FetchAreaTable(ctx context.Context, client *http.Client) (*RawAreaTable, error) {
+	var result RawAreaTable
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var body []byte
+
+	areaTableCacheMutex.Lock()
+	defer areaTableCacheMutex.Unlock()
+	if areaTableCache != nil {
+		return areaTableCache, nil
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, AREA_TABLE_URL, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create a request for the area table: %v", err)
+		goto weather_fetchareatable_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch the area table (url: %s): %v", AREA_TABLE_URL, err)
+		goto weather_fetchareatable_finish
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch the area table (url: %s): %s", AREA_TABLE_URL, resp.Status)
+		goto weather_fetchareatable_finish
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read the area table body (url: %s)", AREA_TABLE_URL)
+		goto weather_fetchareatable_finish
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		err = fmt.Errorf("failed to unmarshal the area table json (url: %s)", AREA_TABLE_URL)
+		goto weather_fetchareatable_finish
+	}
+	areaTableCache = &result
+
+weather_fetchareatable_finish:
+	return areaTableCache, err
+}
+
+// OfficeCodeOf returns the forecast office code responsible for the area, following its parents in the area table.
+// Hokkaido, Okinawa and Amami have several offices per prefecture, so the office is not derived from the prefecture.
+func (t RawAreaTable) OfficeCodeOf(area_code string) (string, error) {
+	code := area_code
+	for _, class := range []map[string]RawAreaEntry{t.Class20s, t.Class15s, t.Class10s} {
+		if entry, ok := class[code]; ok {
+			code = entry.Parent
+		}
+	}
+	if _, ok := t.Offices[code]; !ok {
+		return "", fmt.Errorf("no forecast office found for area %s", area_code)
+	}
+	return code, nil
+}
+
+// FetchWarningData fetches the warnings and advisories issued by a JMA forecast office.
+func FetchWarningData(ctx context.Context, client *http.Client, office_code string) (RawWarningData, error) {
+	var result RawWarningData
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var body []byte
+
+	url := fmt.Sprintf("https://www.jma.go.jp/bosai/warning/data/warning/%s.json", office_code)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create a request for warning data: %v", err)
+		goto weather_fetchwarningdata_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch warning data (url: %s): %v", url, err)
+		goto weather_fetchwarningdata_finish
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch warning data (url: %s): %s", url, resp.Status)
+		goto weather_fetchwarningdata_finish
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read warning data body (url: %s)", url)
+		goto weather_fetchwarningdata_finish
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		err = fmt.Errorf("failed to unmarshal warning data json (url: %s)", url)
+		goto weather_fetchwarningdata_finish
+	}
+
+weather_fetchwarningdata_finish:
+	return result, err
+}
+
+// ParseWarningData extracts the warnings in effect for the area from the office's warning data.
+// The banner alert is set when a warning of BANNER_WARNING_CODES is in effect.
+func ParseWarningData(data RawWarningData, area_code, location_name string) (WarningData, error) {
+	var warningData WarningData
+	var area *RawWarningArea
+	var names, bannerNames []string
+
+	for i := range data.AreaTypes {
+		for j := range data.AreaTypes[i].Areas {
+			if data.AreaTypes[i].Areas[j].Code == area_code {
+				area = &data.AreaTypes[i].Areas[j]
+			}
+		}
+	}
+	if area == nil {
+		return warningData, fmt.Errorf("no warning data found for area %s", area_code)
+	}
+
+	warningData = WarningData{
+		ReportDatetime: data.ReportDatetime,
+		Headline:       strings.TrimSpace(data.HeadlineText),
+		Warnings:       []WarningItem{},
+	}
+	for _, item := range area.Warnings {
+		if item.Status == WARNING_STATUS_LIFTED || item.Status == WARNING_STATUS_NONE {
+			continue
+		}
+		kind, ok := warningKinds[item.Code]
+		if !ok {
+			continue
+		}
+		warningData.Warnings = append(warningData.Warnings, WarningItem{
+			Code:   item.Code,
+			Name:   kind.Name,
+			NameEN: kind.NameEN,
+			Level:  kind.Level,
+			Status: item.Status,
+		})
+		names = append(names, kind.Name)
+		if slices.Contains(BANNER_WARNING_CODES, item.Code) {
+			bannerNames = append(bannerNames, kind.Name)
+		}
+	}
+
+	// Emergency warnings come first, then warnings, then advisories.
+	levelOrder := map[WarningLevel]int{EmergencyWarning: 0, Warning: 1, Advisory: 2}
+	slices.SortStableFunc(warningData.Warnings, func(a WarningItem, b WarningItem) int {
+		return levelOrder[a.Level] - levelOrder[b.Level]
+	})
+
+	warningData.Summary = "No warnings"
+	if len(names) > 0 {
+		warningData.Summary = strings.Join(names, "・")
+	}
+	if len(bannerNames) > 0 {
+		warningData.Alert = fmt.Sprintf("%s: %s", location_name, strings.Join(bannerNames, "・"))
+	}
+	return warningData, nil
+}
+
+// WeatherWarningsCheckQuery checks and validates query parameters for weather warnings requests.
+func WeatherWarningsCheckQuery(c *gin.Context) (layout.WidgetSize, string, string, string, error) {
+	var err error
+
+	size_str := c.Query("size")
+	location_name := c.Query("location_name")
+	area_code := c.Query("warning_area")
+	office_code := c.Query("warning_office")
+
+	if size_str == "" {
+		err = fmt.Errorf("please provide size information")
+		goto weatherwarnings_checkquery_finish
+
+	} else if !layout.SizeCheck(layout.WeatherWarningsWidget, (layout.WidgetSize)(size_str)) {
+		err = fmt.Errorf("invalid size")
+		goto weatherwarnings_checkquery_finish
+	}
+
+	if location_name == "" || !areaCodeRegex.MatchString(area_code) {
+		err = fmt.Errorf("please provide location information with a valid JMA area code")
+		goto weatherwarnings_checkquery_finish
+	}
+	if office_code != "" && !officeCodeRegex.MatchString(office_code) {
+		err = fmt.Errorf("invalid JMA forecast office code")
+		goto weatherwarnings_checkquery_finish
+	}
+
+weatherwarnings_checkquery_finish:
+	return (layout.WidgetSize)(size_str), location_name, area_code, office_code, err
+}
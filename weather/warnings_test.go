@@ -0,0 +1,45 @@
+package weather
+
+import "testing"
+
+func TestOfficeCodeOf(t *testing.T) {
+	table := RawAreaTable{
+		Offices: map[string]RawAreaEntry{
+			"016000": {Name: "石狩・空知・後志地方"},
+			"130000": {Name: "東京都"},
+			"471000": {Name: "沖縄本島地方"},
+		},
+		Class10s: map[string]RawAreaEntry{
+			"016010": {Name: "石狩地方", Parent: "016000"},
+			"130010": {Name: "東京地方", Parent: "130000"},
+			"471010": {Name: "本島中南部", Parent: "471000"},
+		},
+		Class15s: map[string]RawAreaEntry{
+			"016011": {Name: "札幌地方", Parent: "016010"},
+			"130011": {Name: "23区西部", Parent: "130010"},
+			"471011": {Name: "那覇地方", Parent: "471010"},
+		},
+		Class20s: map[string]RawAreaEntry{
+			"0110000": {Name: "札幌市", Parent: "016011"},
+			"1310100": {Name: "千代田区", Parent: "130011"},
+			"4720100": {Name: "那覇市", Parent: "471011"},
+		},
+	}
+	tests := []struct {
+		area   string
+		office string
+	}{
+		{"0110000", "016000"},
+		{"016010", "016000"},
+		{"1310100", "130000"},
+		{"4720100", "471000"},
+		{"471010", "471000"},
+		{"9990000", ""},
+	}
+	for _, tt := range tests {
+		office, err := table.OfficeCodeOf(tt.area)
+		if office != tt.office || (err != nil) != (tt.office == "") {
+			t.Errorf("OfficeCodeOf(%s) = %s, %v, want %s", tt.area, office, err, tt.office)
+		}
+	}
+}
@@ -2,11 +2,18 @@
 package weather
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kken7231/screensaver/layout"
@@ -199,6 +206,10 @@ func WeatherForecastCheckQuery(c *gin.Context) (layout.WidgetSize, string, float
 		err = fmt.Errorf("please provide the amedas location code for historical data (Specific parameter for MiddleV)")
 		goto weatherforecast_checkquery_finish
 	}
+	if amedas_code != "" && !ValidAmedasCode(amedas_code) {
+		err = fmt.Errorf("please provide a valid amedas location code")
+		goto weatherforecast_checkquery_finish
+	}
 	latitude, err = strconv.ParseFloat(latitude_str, 64)
 	if err != nil {
 		err = fmt.Errorf("please provide valid latitude information")
@@ -216,31 +227,65 @@ weatherforecast_checkquery_finish:
 
 // RawCurrentData represents the current weather data.
 type RawCurrentData struct {
-	Temperature2M float64 `json:"temperature_2m"`
-	WeatherCode   int     `json:"weather_code"`
+	Temperature2M       float64  `json:"temperature_2m"`
+	ApparentTemperature *float64 `json:"apparent_temperature"`
+	RelativeHumidity2M  *float64 `json:"relative_humidity_2m"`
+	Precipitation       *float64 `json:"precipitation"`
+	WeatherCode         int      `json:"weather_code"`
+	WindSpeed10M        *float64 `json:"wind_speed_10m"`
+	WindDirection10M    *float64 `json:"wind_direction_10m"`
+	WindGusts10M        *float64 `json:"wind_gusts_10m"`
 }
 
 // RawHourlyData represents the hourly weather data.
+// Variables the JMA model does not provide are returned as null and kept as nil pointers.
 type RawHourlyData struct {
-	Time          []string  `json:"time"`
-	Temperature2M []float64 `json:"temperature_2m"`
-	WeatherCode   []int     `json:"weather_code"`
+	Time                     []string   `json:"time"`
+	Temperature2M            []float64  `json:"temperature_2m"`
+	ApparentTemperature      []*float64 `json:"apparent_temperature"`
+	RelativeHumidity2M       []*float64 `json:"relative_humidity_2m"`
+	Precipitation            []*float64 `json:"precipitation"`
+	PrecipitationProbability []*float64 `json:"precipitation_probability"`
+	WeatherCode              []int      `json:"weather_code"`
+	WindSpeed10M             []*float64 `json:"wind_speed_10m"`
+	WindDirection10M         []*float64 `json:"wind_direction_10m"`
+	WindGusts10M             []*float64 `json:"wind_gusts_10m"`
+	UVIndex                  []*float64 `json:"uv_index"`
+	ShortwaveRadiation       []*float64 `json:"shortwave_radiation"`
 }
 
 // RawDailyData represents the daily weather data.
+// Variables the JMA model does not provide are returned as null and kept as nil pointers.
 type RawDailyData struct {
-	Time             []string  `json:"time"`
-	WeatherCode      []int     `json:"weather_code"`
-	Temperature2MMax []float64 `json:"temperature_2m_max"`
-	Temperature2MMin []float64 `json:"temperature_2m_min"`
+	Time                        []string   `json:"time"`
+	WeatherCode                 []int      `json:"weather_code"`
+	Temperature2MMax            []float64  `json:"temperature_2m_max"`
+	Temperature2MMin            []float64  `json:"temperature_2m_min"`
+	ApparentTemperatureMax      []*float64 `json:"apparent_temperature_max"`
+	ApparentTemperatureMin      []*float64 `json:"apparent_temperature_min"`
+	Sunrise                     []string   `json:"sunrise"`
+	Sunset                      []string   `json:"sunset"`
+	PrecipitationSum            []*float64 `json:"precipitation_sum"`
+	PrecipitationProbabilityMax []*float64 `json:"precipitation_probability_max"`
+	WindSpeed10MMax             []*float64 `json:"wind_speed_10m_max"`
+	WindGusts10MMax             []*float64 `json:"wind_gusts_10m_max"`
+	WindDirection10MDominant    []*float64 `json:"wind_direction_10m_dominant"`
+	UVIndexMax                  []*float64 `json:"uv_index_max"`
+}
+
+// RawMinutely15Data represents the 15-minutely weather data.
+type RawMinutely15Data struct {
+	Time          []string  `json:"time"`
+	Precipitation []float64 `json:"precipitation"`
 }
 
 // RawForecastData represents the complete forecast data.
 type RawForecastData struct {
-	Timezone string         `json:"timezone"`
-	Current  RawCurrentData `json:"current"`
-	Hourly   RawHourlyData  `json:"hourly"`
-	Daily    RawDailyData   `json:"daily"`
+	Timezone   string            `json:"timezone"`
+	Current    RawCurrentData    `json:"current"`
+	Minutely15 RawMinutely15Data `json:"minutely_15"`
+	Hourly     RawHourlyData     `json:"hourly"`
+	Daily      RawDailyData      `json:"daily"`
 }
 
 // HourIndex represents an hourly index for weather data.
@@ -257,35 +302,129 @@ type DayIndex struct {
 
 // CurrentData represents the current weather data for display.
 type CurrentData struct {
-	Temp        string `json:"temp"`
-	WeatherIcon string `json:"weather_icon"`
-	WeatherName string `json:"weather_name"`
+	Temp          string `json:"temp"`
+	ApparentTemp  string `json:"apparent_temp"`
+	Humidity      string `json:"humidity"`
+	Precipitation string `json:"precipitation"`
+	Wind          string `json:"wind"`
+	WindGusts     string `json:"wind_gusts"`
+	WindDirection string `json:"wind_direction"`
+	WeatherIcon   string `json:"weather_icon"`
+	WeatherName   string `json:"weather_name"`
 }
 
 // HourlyData represents the hourly weather data for display.
 type HourlyData struct {
-	Time        string `json:"time"`
-	Temp        string `json:"temp"`
-	WeatherIcon string `json:"weather_icon"`
-	WeatherName string `json:"weather_name"`
+	Time                     string `json:"time"`
+	Temp                     string `json:"temp"`
+	ApparentTemp             string `json:"apparent_temp"`
+	Humidity                 string `json:"humidity"`
+	Precipitation            string `json:"precipitation"`
+	PrecipitationProbability string `json:"precipitation_probability"`
+	Wind                     string `json:"wind"`
+	WindDirection            string `json:"wind_direction"`
+	UVIndex                  string `json:"uv_index"`
+	WeatherIcon              string `json:"weather_icon"`
+	WeatherName              string `json:"weather_name"`
 }
 
 // DailyData represents the daily weather data for display.
 type DailyData struct {
-	Time        string `json:"time"`
-	TempMax     string `json:"temp_max"`
-	TempMin     string `json:"temp_min"`
-	WeatherIcon string `json:"weather_icon"`
-	WeatherName string `json:"weather_name"`
+	Time                     string `json:"time"`
+	TempMax                  string `json:"temp_max"`
+	TempMin                  string `json:"temp_min"`
+	ApparentTempMax          string `json:"apparent_temp_max"`
+	ApparentTempMin          string `json:"apparent_temp_min"`
+	Sunrise                  string `json:"sunrise"`
+	Sunset                   string `json:"sunset"`
+	Precipitation            string `json:"precipitation"`
+	PrecipitationProbability string `json:"precipitation_probability"`
+	WindMax                  string `json:"wind_max"`
+	WindGustsMax             string `json:"wind_gusts_max"`
+	WindDirection            string `json:"wind_direction"`
+	UVIndexMax               string `json:"uv_index_max"`
+	WeatherIcon              string `json:"weather_icon"`
+	WeatherName              string `json:"weather_name"`
 }
 
 // ForecastData represents the complete forecast data for display.
 type ForecastData struct {
 	Current CurrentData  `json:"current"`
+	Today   DailyData    `json:"today"`
 	Hourly  []HourlyData `json:"hourly"`
 	Daily   []DailyData  `json:"daily"`
 }
 
+// compassPoints are the 16 compass points used for wind directions.
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// FormatWindDirection converts a wind direction in degrees into a compass point.
+func FormatWindDirection(degrees float64) string {
+	return compassPoints[int(math.Round(math.Mod(degrees+360, 360)/22.5))%16]
+}
+
+// formatCurrent formats a current value, or returns util.MISSING_VALUE when the model does not provide it.
+func formatCurrent(format string, value *float64) string {
+	if value == nil {
+		return util.MISSING_VALUE
+	}
+	return fmt.Sprintf(format, *value)
+}
+
+// pointerAt returns the i-th value, or nil when it is missing from the response.
+func pointerAt(values []*float64, i int) *float64 {
+	if i >= len(values) {
+		return nil
+	}
+	return values[i]
+}
+
+// formatOptional formats the i-th value, or returns util.MISSING_VALUE when the model does not provide it.
+func formatOptional(format string, values []*float64, i int) string {
+	return formatCurrent(format, pointerAt(values, i))
+}
+
+// formatDirection formats a wind direction as a compass point, or returns util.MISSING_VALUE when the model does not provide it.
+func formatDirection(degrees *float64) string {
+	if degrees == nil {
+		return util.MISSING_VALUE
+	}
+	return FormatWindDirection(*degrees)
+}
+
+// formatClock formats an ISO 8601 local time such as "2024-06-01T04:52" as "04:52".
+func formatClock(values []string, i int) string {
+	if i >= len(values) {
+		return util.MISSING_VALUE
+	}
+	t, err := time.Parse("2006-01-02T15:04", values[i])
+	if err != nil {
+		return util.MISSING_VALUE
+	}
+	return t.Format("15:04")
+}
+
+// parseDailyData formats the i-th day of the daily weather data for display.
+func parseDailyData(daily RawDailyData, i int, timeDesc string) DailyData {
+	return DailyData{
+		Time:                     timeDesc,
+		TempMax:                  fmt.Sprintf(util.TEMP_FORMAT_DAY, daily.Temperature2MMax[i]),
+		TempMin:                  fmt.Sprintf(util.TEMP_FORMAT_DAY, daily.Temperature2MMin[i]),
+		ApparentTempMax:          formatOptional(util.TEMP_FORMAT_DAY, daily.ApparentTemperatureMax, i),
+		ApparentTempMin:          formatOptional(util.TEMP_FORMAT_DAY, daily.ApparentTemperatureMin, i),
+		Sunrise:                  formatClock(daily.Sunrise, i),
+		Sunset:                   formatClock(daily.Sunset, i),
+		Precipitation:            formatOptional(util.PRECIPITATION_FORMAT, daily.PrecipitationSum, i),
+		PrecipitationProbability: formatOptional(util.PROBABILITY_FORMAT, daily.PrecipitationProbabilityMax, i),
+		WindMax:                  formatOptional(util.WIND_FORMAT, daily.WindSpeed10MMax, i),
+		WindGustsMax:             formatOptional(util.WIND_FORMAT, daily.WindGusts10MMax, i),
+		WindDirection:            formatDirection(pointerAt(daily.WindDirection10MDominant, i)),
+		UVIndexMax:               formatOptional(util.UV_FORMAT, daily.UVIndexMax, i),
+		WeatherIcon:              weatherIcons[WeatherCode(int64(daily.WeatherCode[i]))],
+		WeatherName:              GetWeatherDescriptions(WeatherCode(int64(daily.WeatherCode[i])), DEFAULT_LANG),
+	}
+}
+
 // FindNextNHours finds the next N hours of weather data from the provided time strings.
 func FindNextNHours(datetimes []string, datetimesTimezone string, nHour int) ([]HourIndex, error) {
 	var err error
@@ -372,39 +511,106 @@ weather_findnextdays_finish:
 	return indices, err
 }
 
-// FetchForecastData fetches weather forecast data from the Open Meteo API.
-func FetchForecastData(latitude, longitude float64, nDay int) (RawForecastData, error) {
-	var result RawForecastData
+// Variables requested from the Open Meteo API.
+const (
+	CURRENT_VARIABLES = "temperature_2m,apparent_temperature,relative_humidity_2m,precipitation,weather_code,wind_speed_10m,wind_direction_10m,wind_gusts_10m"
+	HOURLY_VARIABLES  = "temperature_2m,apparent_temperature,relative_humidity_2m,precipitation,precipitation_probability,weather_code,wind_speed_10m,wind_direction_10m,wind_gusts_10m,uv_index,shortwave_radiation"
+	DAILY_VARIABLES   = "weather_code,temperature_2m_max,temperature_2m_min,apparent_temperature_max,apparent_temperature_min,sunrise,sunset,precipitation_sum,precipitation_probability_max,wind_speed_10m_max,wind_gusts_10m_max,wind_direction_10m_dominant,uv_index_max"
+)
+
+// DEFAULT_TIMEZONE is the time zone of the forecasts of locations without one.
+const DEFAULT_TIMEZONE = "Asia/Tokyo"
+
+// LocationTimezone validates the time zone of a location, defaulting to DEFAULT_TIMEZONE when it is empty.
+func LocationTimezone(timezone string) (string, error) {
+	if timezone == "" {
+		return DEFAULT_TIMEZONE, nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return "", fmt.Errorf("invalid time zone \"%s\"", timezone)
+	}
+	return timezone, nil
+}
+
+// FetchForecastData fetches weather forecast data in the time zone from the Open Meteo API.
+func FetchForecastData(ctx context.Context, client *http.Client, latitude, longitude float64, timezone string, nDay int) (RawForecastData, error) {
+	results, err := FetchForecastDataBatch(ctx, client, []float64{latitude}, []float64{longitude}, []string{timezone}, nDay)
+	if err != nil {
+		return RawForecastData{}, err
+	}
+	return results[0], nil
+}
+
+// FetchForecastDataBatch fetches weather forecast data of several locations in one Open Meteo API request.
+// The results are in the order of the given coordinates, each in the time zone at the same index.
+func FetchForecastDataBatch(ctx context.Context, client *http.Client, latitudes, longitudes []float64, timezones []string, nDay int) ([]RawForecastData, error) {
+	var results []RawForecastData
 	var err error
+	var req *http.Request
 	var resp *http.Response
 	var body []byte
+	var latitudeStrs, longitudeStrs []string
 
-	url := fmt.Sprintf("https://api.open-meteo.com/v1/jma?latitude=%f&longitude=%f&current=temperature_2m,weather_code&hourly=temperature_2m,weather_code&daily=weather_code,temperature_2m_max,temperature_2m_min&timezone=Asia%%2FTokyo&forecast_days=%d",
-		latitude,
-		longitude,
+	for i := range latitudes {
+		latitudeStrs = append(latitudeStrs, fmt.Sprintf("%f", latitudes[i]))
+		longitudeStrs = append(longitudeStrs, fmt.Sprintf("%f", longitudes[i]))
+	}
+	timezonesStr := url.QueryEscape(strings.Join(timezones, ","))
+
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/jma?latitude=%s&longitude=%s&current=%s&minutely_15=precipitation&forecast_minutely_15=%d&hourly=%s&daily=%s&wind_speed_unit=ms&timezone=%s&forecast_days=%d",
+		strings.Join(latitudeStrs, ","),
+		strings.Join(longitudeStrs, ","),
+		CURRENT_VARIABLES,
+		NOWCAST_STEPS,
+		HOURLY_VARIABLES,
+		DAILY_VARIABLES,
+		timezonesStr,
 		nDay+1,
 	)
 
-	resp, err = http.Get(url)
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		err = fmt.Errorf("failed to fetch weather data (url: %s)", url)
-		goto weather_fetchforecastdata_finish
+		err = fmt.Errorf("failed to create a request for weather data: %v", err)
+		goto weather_fetchforecastdatabatch_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch weather data (url: %s): %v", url, err)
+		goto weather_fetchforecastdatabatch_finish
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch weather data (url: %s): %s", url, resp.Status)
+		goto weather_fetchforecastdatabatch_finish
+	}
+
 	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		err = fmt.Errorf("failed to read weather data body (url: %s)", url)
-		goto weather_fetchforecastdata_finish
+		goto weather_fetchforecastdatabatch_finish
 	}
 
-	if err = json.Unmarshal(body, &result); err != nil {
+	// A single location is returned as an object, several locations as an array.
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(body, &results)
+	} else {
+		results = make([]RawForecastData, 1)
+		err = json.Unmarshal(body, &results[0])
+	}
+	if err != nil {
 		err = fmt.Errorf("failed to unmarshal weather data json (url: %s)", url)
-		goto weather_fetchforecastdata_finish
+		goto weather_fetchforecastdatabatch_finish
 	}
 
-weather_fetchforecastdata_finish:
-	return result, err
+	if len(results) != len(latitudes) {
+		err = fmt.Errorf("expected weather data of %d locations but got %d (url: %s)", len(latitudes), len(results), url)
+		goto weather_fetchforecastdatabatch_finish
+	}
+
+weather_fetchforecastdatabatch_finish:
+	return results, err
 }
 
 // ParseForecastData parses the raw forecast data into structured forecast data for display.
@@ -413,6 +619,7 @@ func ParseForecastData(data RawForecastData, nHour, nDay int) (ForecastData, err
 	var nextDays []DayIndex
 	var err error
 	var current CurrentData
+	var today DailyData
 	var hourlyDataCol []HourlyData
 	var dailyDataCol []DailyData
 
@@ -420,9 +627,15 @@ func ParseForecastData(data RawForecastData, nHour, nDay int) (ForecastData, err
 	timezone := data.Timezone
 
 	current = CurrentData{
-		Temp:        fmt.Sprintf(util.TEMP_FORMAT_CUR, data.Current.Temperature2M),
-		WeatherIcon: weatherIcons[WeatherCode(data.Current.WeatherCode)],
-		WeatherName: GetWeatherDescriptions(WeatherCode(data.Current.WeatherCode), DEFAULT_LANG),
+		Temp:          fmt.Sprintf(util.TEMP_FORMAT_CUR, data.Current.Temperature2M),
+		ApparentTemp:  formatCurrent(util.TEMP_FORMAT_CUR, data.Current.ApparentTemperature),
+		Humidity:      formatCurrent(util.HUMIDITY_FORMAT, data.Current.RelativeHumidity2M),
+		Precipitation: formatCurrent(util.PRECIPITATION_FORMAT, data.Current.Precipitation),
+		Wind:          formatCurrent(util.WIND_FORMAT, data.Current.WindSpeed10M),
+		WindGusts:     formatCurrent(util.WIND_FORMAT, data.Current.WindGusts10M),
+		WindDirection: formatDirection(data.Current.WindDirection10M),
+		WeatherIcon:   weatherIcons[WeatherCode(data.Current.WeatherCode)],
+		WeatherName:   GetWeatherDescriptions(WeatherCode(data.Current.WeatherCode), DEFAULT_LANG),
 	}
 
 	nextHours, err = FindNextNHours(data.Hourly.Time, timezone, nHour)
@@ -434,10 +647,17 @@ func ParseForecastData(data RawForecastData, nHour, nDay int) (ForecastData, err
 	hourlyDataCol = make([]HourlyData, nHour)
 	for i, nextData := range nextHours {
 		hourlyDataCol[i] = HourlyData{
-			Time:        fmt.Sprintf("%d", nextData.Time),
-			Temp:        fmt.Sprintf(util.TEMP_FORMAT_HOUR, data.Hourly.Temperature2M[nextData.Index]),
-			WeatherIcon: weatherIcons[WeatherCode(int64(data.Hourly.WeatherCode[nextData.Index]))],
-			WeatherName: GetWeatherDescriptions(WeatherCode(int64(data.Hourly.WeatherCode[nextData.Index])), DEFAULT_LANG),
+			Time:                     fmt.Sprintf("%d", nextData.Time),
+			Temp:                     fmt.Sprintf(util.TEMP_FORMAT_HOUR, data.Hourly.Temperature2M[nextData.Index]),
+			ApparentTemp:             formatOptional(util.TEMP_FORMAT_HOUR, data.Hourly.ApparentTemperature, nextData.Index),
+			Humidity:                 formatOptional(util.HUMIDITY_FORMAT, data.Hourly.RelativeHumidity2M, nextData.Index),
+			Precipitation:            formatOptional(util.PRECIPITATION_FORMAT, data.Hourly.Precipitation, nextData.Index),
+			PrecipitationProbability: formatOptional(util.PROBABILITY_FORMAT, data.Hourly.PrecipitationProbability, nextData.Index),
+			Wind:                     formatOptional(util.WIND_FORMAT, data.Hourly.WindSpeed10M, nextData.Index),
+			WindDirection:            formatDirection(pointerAt(data.Hourly.WindDirection10M, nextData.Index)),
+			UVIndex:                  formatOptional(util.UV_FORMAT, data.Hourly.UVIndex, nextData.Index),
+			WeatherIcon:              weatherIcons[WeatherCode(int64(data.Hourly.WeatherCode[nextData.Index]))],
+			WeatherName:              GetWeatherDescriptions(WeatherCode(int64(data.Hourly.WeatherCode[nextData.Index])), DEFAULT_LANG),
 		}
 	}
 
@@ -449,49 +669,101 @@ func ParseForecastData(data RawForecastData, nHour, nDay int) (ForecastData, err
 
 	dailyDataCol = make([]DailyData, nDay)
 	for i, nextData := range nextDays {
-		dailyDataCol[i] = DailyData{
-			Time:        fmt.Sprintf("%d", nextData.Time),
-			TempMax:     fmt.Sprintf(util.TEMP_FORMAT_DAY, data.Daily.Temperature2MMax[nextData.Index]),
-			TempMin:     fmt.Sprintf(util.TEMP_FORMAT_DAY, data.Daily.Temperature2MMin[nextData.Index]),
-			WeatherIcon: weatherIcons[WeatherCode(int64(data.Daily.WeatherCode[nextData.Index]))],
-			WeatherName: GetWeatherDescriptions(WeatherCode(int64(data.Daily.WeatherCode[nextData.Index])), DEFAULT_LANG),
+		dailyDataCol[i] = parseDailyData(data.Daily, nextData.Index, fmt.Sprintf("%d", nextData.Time))
+	}
+
+	// Today precedes the first forthcoming day.
+	if len(nextDays) > 0 && nextDays[0].Index > 0 {
+		todayDesc := ""
+		if todayDate, err := time.Parse("2006-01-02", data.Daily.Time[nextDays[0].Index-1]); err == nil {
+			todayDesc = fmt.Sprintf("%d", todayDate.Day())
 		}
+		today = parseDailyData(data.Daily, nextDays[0].Index-1, todayDesc)
 	}
 
 weather_parseforecastdata_finish:
-	return ForecastData{current, hourlyDataCol, dailyDataCol}, err
+	return ForecastData{
+		Current: current,
+		Today:   today,
+		Hourly:  hourlyDataCol,
+		Daily:   dailyDataCol,
+	}, err
+}
+
+// Quality flags of AMeDAS values accepted as observed: normal and quasi-normal.
+const (
+	AMEDAS_QUALITY_NORMAL       = 0
+	AMEDAS_QUALITY_QUASI_NORMAL = 1
+)
+
+// AmedasValue represents an AMeDAS value followed by its quality flag, either of which is null or absent when not observed.
+type AmedasValue []*float64
+
+// Get returns the value, or false when it was not observed or its quality flag is not normal.
+func (v AmedasValue) Get() (float64, bool) {
+	if len(v) < 2 || v[0] == nil || v[1] == nil {
+		return 0, false
+	}
+	if flag := *v[1]; flag != AMEDAS_QUALITY_NORMAL && flag != AMEDAS_QUALITY_QUASI_NORMAL {
+		return 0, false
+	}
+	return *v[0], true
+}
+
+// Ptr returns a pointer to the value, or nil when Get reports it as not observed.
+func (v AmedasValue) Ptr() *float64 {
+	if value, ok := v.Get(); ok {
+		return &value
+	}
+	return nil
+}
+
+// IntPtr returns a pointer to the value as an integer code, or nil when Get reports it as not observed.
+func (v AmedasValue) IntPtr() *int {
+	if value, ok := v.Get(); ok {
+		code := int(value)
+		return &code
+	}
+	return nil
 }
 
 // RawHistoricalData represents the historical weather data.
 type RawHistoricalData struct {
-	Temp             [2]float64 `json:"temp"`
-	Humidity         [2]float64 `json:"humidity"`
-	Weather          [2]int     `json:"weather"`
-	Precipitation10m [2]float64 `json:"precipitation10m"`
-	Wind             [2]float64 `json:"wind"`
-	WindDirection    [2]int     `json:"windDirection"`
-	NormalPressure   [2]float64 `json:"normalPressure"`
+	Temp             AmedasValue `json:"temp"`
+	Humidity         AmedasValue `json:"humidity"`
+	Weather          AmedasValue `json:"weather"`
+	Precipitation10m AmedasValue `json:"precipitation10m"`
+	Wind             AmedasValue `json:"wind"`
+	WindDirection    AmedasValue `json:"windDirection"`
+	NormalPressure   AmedasValue `json:"normalPressure"`
 }
 
 // RawHistoricalDataMap maps timestamps to RawHistoricalData.
 type RawHistoricalDataMap map[string]RawHistoricalData
 
-// HistoricalData represents the structured historical weather data.
+// HistoricalData represents the structured historical weather data. Values not observed are nil.
 type HistoricalData struct {
-	Timestamp        int64   `json:"timestamp"`
-	Temp             float64 `json:"temp"`
-	Humidity         float64 `json:"humidity"`
-	Weather          int     `json:"weather"`
-	Precipitation10m float64 `json:"precipitation10m"`
-	Wind             float64 `json:"wind"`
-	WindDirection    int     `json:"windDirection"`
-	NormalPressure   float64 `json:"normalPressure"`
+	Timestamp        int64    `json:"timestamp"`
+	Temp             *float64 `json:"temp"`
+	Humidity         *float64 `json:"humidity"`
+	Weather          *int     `json:"weather"`
+	Precipitation10m *float64 `json:"precipitation10m"`
+	Wind             *float64 `json:"wind"`
+	WindDirection    *int     `json:"windDirection"`
+	NormalPressure   *float64 `json:"normalPressure"`
 }
 
+// ErrNotPublished is returned when JMA has not published the requested chunk yet.
+var ErrNotPublished = errors.New("historical weather data is not published yet")
+
+// AMEDAS_FETCH_PARALLELISM is the maximum number of chunks fetched concurrently.
+const AMEDAS_FETCH_PARALLELISM = 4
+
 // FetchHistWeatherData fetches historical weather data from the JMA API.
-func FetchHistWeatherData(amedas_code string, ofWhen time.Time, quarterIndex int) (RawHistoricalDataMap, error) {
+func FetchHistWeatherData(ctx context.Context, client *http.Client, amedas_code string, ofWhen time.Time, quarterIndex int) (RawHistoricalDataMap, error) {
 	var weatherData RawHistoricalDataMap
 	var err error
+	var req *http.Request
 	var resp *http.Response
 	var body []byte
 
@@ -503,13 +775,27 @@ func FetchHistWeatherData(amedas_code string, ofWhen time.Time, quarterIndex int
 		quarterIndex*3,
 	)
 
-	resp, err = http.Get(url)
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		err = fmt.Errorf("failed to fetch historical weather data (url: %s)", url)
+		err = fmt.Errorf("failed to create a request for historical weather data: %v", err)
+		goto weatherforecast_fetchhistoricaldata_finish
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch historical weather data (url: %s): %v", url, err)
 		goto weatherforecast_fetchhistoricaldata_finish
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		err = fmt.Errorf("%w (url: %s)", ErrNotPublished, url)
+		goto weatherforecast_fetchhistoricaldata_finish
+	} else if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch historical weather data (url: %s): %s", url, resp.Status)
+		goto weatherforecast_fetchhistoricaldata_finish
+	}
+
 	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		err = fmt.Errorf("failed to read historical weather data body (url: %s)", url)
@@ -525,6 +811,42 @@ weatherforecast_fetchhistoricaldata_finish:
 	return weatherData, err
 }
 
+// FetchHistWeatherDataOfDay fetches the 3-hour chunks of the day up to the last quarter concurrently.
+// Chunks that are not published yet are skipped, so the result may be a partial series.
+func FetchHistWeatherDataOfDay(ctx context.Context, client *http.Client, amedas_code string, ofWhen time.Time, lastQuarter int) ([]RawHistoricalDataMap, error) {
+	chunks := make([]RawHistoricalDataMap, lastQuarter+1)
+	errs := make([]error, lastQuarter+1)
+	sem := make(chan struct{}, AMEDAS_FETCH_PARALLELISM)
+	var wg sync.WaitGroup
+
+	for i := 0; i <= lastQuarter; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			chunks[i], errs[i] = FetchHistWeatherData(ctx, client, amedas_code, ofWhen, i)
+		}(i)
+	}
+	wg.Wait()
+
+	var published []RawHistoricalDataMap
+	for i, err := range errs {
+		if errors.Is(err, ErrNotPublished) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		published = append(published, chunks[i])
+	}
+	return published, nil
+}
+
 // ParseHistWeatherData parses raw historical weather data into structured historical data.
 func ParseHistWeatherData(rawWeatherData RawHistoricalDataMap) ([]HistoricalData, error) {
 	// Create a slice to hold the compacted data
@@ -540,13 +862,13 @@ func ParseHistWeatherData(rawWeatherData RawHistoricalDataMap) ([]HistoricalData
 
 		compactedData = append(compactedData, HistoricalData{
 			Timestamp:        timestamp_int,
-			Temp:             data.Temp[0],
-			Humidity:         data.Humidity[0],
-			Weather:          data.Weather[0],
-			Precipitation10m: data.Precipitation10m[0],
-			Wind:             data.Wind[0],
-			WindDirection:    data.WindDirection[0],
-			NormalPressure:   data.NormalPressure[0],
+			Temp:             data.Temp.Ptr(),
+			Humidity:         data.Humidity.Ptr(),
+			Weather:          data.Weather.IntPtr(),
+			Precipitation10m: data.Precipitation10m.Ptr(),
+			Wind:             data.Wind.Ptr(),
+			WindDirection:    data.WindDirection.IntPtr(),
+			NormalPressure:   data.NormalPressure.Ptr(),
 		})
 	}
 	return compactedData, err
@@ -0,0 +1,39 @@
+package weather
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kken7231/screensaver/util"
+)
+
+func TestParseDailyDataShowsMissingValues(t *testing.T) {
+	var daily RawDailyData
+	err := json.Unmarshal([]byte(`{
+		"time": ["2024-08-01"],
+		"weather_code": [1],
+		"temperature_2m_max": [33.2],
+		"temperature_2m_min": [26.1],
+		"wind_speed_10m_max": [4.2],
+		"wind_gusts_10m_max": [null],
+		"wind_direction_10m_dominant": [null]
+	}`), &daily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := parseDailyData(daily, 0, "Today")
+	if day.WindMax != "4.2 m/s" {
+		t.Errorf("got wind %q, want 4.2 m/s", day.WindMax)
+	}
+	for name, value := range map[string]string{
+		"wind gusts":        day.WindGustsMax,
+		"wind direction":    day.WindDirection,
+		"precipitation":     day.Precipitation,
+		"apparent temp max": day.ApparentTempMax,
+		"sunrise":           day.Sunrise,
+	} {
+		if value != util.MISSING_VALUE {
+			t.Errorf("got %s %q, want %q", name, value, util.MISSING_VALUE)
+		}
+	}
+}